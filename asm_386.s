@@ -1,3 +1,5 @@
+//go:build (!go1.23 || itogami_linkname) && !itogami_portable && !race
+
 #include "textflag.h"
 #include "go_asm.h"
 
@@ -7,5 +9,5 @@
 TEXT ·GetG(SB),NOSPLIT,$0-4
 	get_tls(CX)
 	MOVL	g(CX), AX
-	MOVL	AX, gp+0(FP)
+	MOVL	AX, ret+0(FP)
 	RET
@@ -1,3 +1,5 @@
+//go:build (!go1.23 || itogami_linkname) && !itogami_portable && !race
+
 #include "textflag.h"
 #include "go_asm.h"
 
@@ -5,5 +7,5 @@
 
 TEXT ·GetG(SB),NOSPLIT,$0-8
     get_tls(R1)
-    MOVD    R1, gp+0(FP)
+    MOVD    R1, ret+0(FP)
     RET
@@ -1,9 +1,11 @@
+//go:build (!go1.23 || itogami_linkname) && !itogami_portable && !race
+
 #include "textflag.h"
 #include "go_asm.h"
 
-#define    get_tls(r)    MOVD g, r
+#define    get_tls(r)    MOVW g, r
 
 TEXT ·GetG(SB),NOSPLIT,$0-4
     get_tls(R1)
-    MOVD    R1, gp+0(FP)
+    MOVW    R1, ret+0(FP)
     RET
@@ -7,4 +7,7 @@ const (
 	BenchParam         = 10
 	PoolSize           = 5e4
 	DefaultExpiredTime = 10 * time.Second
+	// small pool kept saturated by many concurrent submitters for measuring the handoff between workers and submitters
+	SaturatedPoolSize    = 8
+	SaturatedParallelism = 64
 )
@@ -49,6 +49,27 @@ func BenchmarkItogamiPool(b *testing.B) {
 	b.StopTimer()
 }
 
+func BenchmarkItogamiPoolBatch(b *testing.B) {
+	var wg sync.WaitGroup
+	p := itogami.NewPool(PoolSize)
+	tasks := make([]func(), RunTimes)
+	for j := range tasks {
+		tasks[j] = func() {
+			demoFunc()
+			wg.Done()
+		}
+	}
+
+	b.ResetTimer()
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		wg.Add(RunTimes)
+		p.SubmitBatch(tasks)
+		wg.Wait()
+	}
+	b.StopTimer()
+}
+
 // func BenchmarkErrGroup(b *testing.B) {
 // 	var wg sync.WaitGroup
 // 	var pool errgroup.Group
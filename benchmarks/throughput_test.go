@@ -52,3 +52,56 @@ func BenchmarkItogamiPoolWithFunc(b *testing.B) {
 	}
 	b.StopTimer()
 }
+
+func BenchmarkItogamiPoolSaturated(b *testing.B) {
+	var wg sync.WaitGroup
+	p := itogami.NewPool(SaturatedPoolSize)
+	defer p.Release()
+
+	b.SetParallelism(SaturatedParallelism)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			wg.Add(1)
+			p.Submit(wg.Done)
+		}
+	})
+	wg.Wait()
+}
+
+func BenchmarkItogamiPoolWithFuncSaturated(b *testing.B) {
+	var wg sync.WaitGroup
+	p := itogami.NewPoolWithFunc(SaturatedPoolSize, func(uint8) { wg.Done() })
+	defer p.Release()
+
+	b.SetParallelism(SaturatedParallelism)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			wg.Add(1)
+			p.Invoke(sleepDuration)
+		}
+	})
+	wg.Wait()
+}
+
+func BenchmarkItogamiPoolWithResult(b *testing.B) {
+	p := itogami.NewPoolWithResult(PoolSize, func(args uint8) (uint8, error) {
+		time.Sleep(time.Duration(args) * time.Millisecond)
+		return args, nil
+	})
+	defer p.Release()
+	futures := make([]*itogami.Future[uint8], RunTimes)
+
+	b.ResetTimer()
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < RunTimes; j++ {
+			futures[j] = p.Invoke(sleepDuration)
+		}
+		for _, f := range futures {
+			f.Get()
+		}
+	}
+	b.StopTimer()
+}
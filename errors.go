@@ -0,0 +1,87 @@
+package itogami
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrPoolClosed is returned when submitting a task to a pool which has been released
+	ErrPoolClosed = errors.New("itogami: pool has been closed")
+
+	// ErrPoolOverload is returned when a non-blocking submission finds all workers of the pool busy
+	// or when a blocking one finds as many submitters already waiting as allowed by WithMaxBlockingTasks
+	ErrPoolOverload = errors.New("itogami: pool is overloaded")
+
+	// ErrRateLimited is returned when a non-blocking submission exceeds the rate limit of the pool
+	ErrRateLimited = errors.New("itogami: pool rate limit exceeded")
+
+	// ErrNoResults is returned when sending a value to a PoolWithResult which was not configured with a results channel
+	ErrNoResults = errors.New("itogami: pool has no results channel")
+
+	// ErrInvalidPoolSize is returned when constructing a pool with a size of zero
+	ErrInvalidPoolSize = errors.New("itogami: pool size must be greater than zero")
+
+	// ErrInvalidOptions is returned when constructing a pool with an invalid configuration
+	ErrInvalidOptions = errors.New("itogami: invalid pool options")
+)
+
+// ItemError holds the error of a single item which failed in a stage of a Pipeline
+type ItemError struct {
+	// position of the stage in the pipeline
+	Stage int
+	Item  any
+	Err   error
+}
+
+// Error implements the error interface
+func (self *ItemError) Error() string {
+	return fmt.Sprintf("itogami: pipeline stage %d failed: %v", self.Stage, self.Err)
+}
+
+// Unwrap returns the error of the item
+func (self *ItemError) Unwrap() error {
+	return self.Err
+}
+
+// PipelineError holds the errors of all the items which failed in a Pipeline
+type PipelineError []*ItemError
+
+// Error implements the error interface
+func (self PipelineError) Error() string {
+	if len(self) == 0 {
+		return "itogami: no pipeline items failed"
+	}
+	return fmt.Sprintf("itogami: %d pipeline items failed, first: %v", len(self), self[0])
+}
+
+// Is reports whether the error of any of the items matches the target, so that errors.Is looks through them
+func (self PipelineError) Is(target error) bool {
+	for _, err := range self {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first error of the items which matches the target, so that errors.As looks through them
+func (self PipelineError) As(target any) bool {
+	for _, err := range self {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// PanicError holds the value recovered from a panicking task along with the stack trace of the panic
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+// Error implements the error interface
+func (self *PanicError) Error() string {
+	return fmt.Sprintf("itogami: task panicked: %v", self.Value)
+}
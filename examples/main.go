@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"sync/atomic"
@@ -27,6 +28,8 @@ func examplePool() {
 	var wg sync.WaitGroup
 	// Use the common pool
 	pool := itogami.NewPool(10)
+	// Release the pool and its workers once done
+	defer pool.Release()
 
 	syncCalculateSum := func() {
 		demoFunc()
@@ -48,6 +51,7 @@ func examplePoolWithFunc() {
 		myFunc(i)
 		wg.Done()
 	})
+	defer pool.Release()
 	for i := uint32(0); i < runTimes; i++ {
 		wg.Add(1)
 		// Invoke the function with a value
@@ -57,7 +61,29 @@ func examplePoolWithFunc() {
 	fmt.Printf("finish all tasks, result is %d\n", sum)
 }
 
+func exampleGroup() {
+	pool := itogami.NewPool(10)
+	defer pool.Release()
+
+	// Many groups can share the same pool, the group context is cancelled on the first error
+	group := pool.Group(context.Background())
+	var total uint32
+	for i := uint32(0); i < runTimes; i++ {
+		i := i
+		group.Go(func() error {
+			atomic.AddUint32(&total, i)
+			return nil
+		})
+	}
+	if err := group.Wait(); err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("finish all grouped tasks, result is %d\n", total)
+}
+
 func main() {
 	examplePool()
 	examplePoolWithFunc()
+	exampleGroup()
 }
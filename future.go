@@ -0,0 +1,114 @@
+package itogami
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+)
+
+// Future represents the pending result of a task submitted via SubmitFuture or PoolWithResult.Invoke
+type Future[R any] struct {
+	// set once the result is available
+	resolved uint32
+	mu       sync.Mutex
+	// created only once someone has to wait for the result, so that a future resolved
+	// before anyone asks for it costs a single allocation
+	done  chan struct{}
+	value R
+	err   error
+}
+
+// shared by all futures which are already resolved when waited on
+var resolvedChan = func() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}()
+
+// SubmitFuture submits a task returning a value to the pool and returns a future for its result
+// a panicking task resolves the future with a *PanicError, the panic is then propagated to the pool
+// so that it is reported to the panic handler and counted in the pool stats like any other panic
+// if the task could not be submitted, the future is resolved with the submission error
+func SubmitFuture[R any](p *Pool, fn func() (R, error)) *Future[R] {
+	f := newFuture[R]()
+	if err := p.Submit(func() { f.run(fn) }); err != nil {
+		var zero R
+		f.resolve(zero, err)
+	}
+	return f
+}
+
+// newFuture returns a new pending future
+func newFuture[R any]() *Future[R] {
+	return new(Future[R])
+}
+
+// run executes the task and resolves the future with its result
+func (self *Future[R]) run(fn func() (R, error)) {
+	defer func() {
+		if r := recover(); r != nil {
+			var zero R
+			self.resolve(zero, &PanicError{Value: r, Stack: debug.Stack()})
+			panic(r)
+		}
+	}()
+	self.resolve(fn())
+}
+
+// resolve sets the result of the future and wakes up everyone waiting for it, must be called only once
+func (self *Future[R]) resolve(value R, err error) {
+	self.value, self.err = value, err
+	self.mu.Lock()
+	atomic.StoreUint32(&self.resolved, 1)
+	if self.done != nil {
+		close(self.done)
+	}
+	self.mu.Unlock()
+}
+
+// wait returns a channel which is closed once the future is resolved
+func (self *Future[R]) wait() <-chan struct{} {
+	if atomic.LoadUint32(&self.resolved) == 1 {
+		return resolvedChan
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if atomic.LoadUint32(&self.resolved) == 1 {
+		return resolvedChan
+	} else if self.done == nil {
+		self.done = make(chan struct{})
+	}
+	return self.done
+}
+
+// Done returns a channel which is closed once the future is resolved
+func (self *Future[R]) Done() <-chan struct{} {
+	return self.wait()
+}
+
+// Get waits for the future to be resolved and returns the result of the task
+func (self *Future[R]) Get() (R, error) {
+	<-self.wait()
+	return self.value, self.err
+}
+
+// GetContext waits for the future to be resolved like Get but returns the context error
+// if the context is done before that
+func (self *Future[R]) GetContext(ctx context.Context) (value R, err error) {
+	select {
+	case <-self.wait():
+		return self.value, self.err
+	case <-ctx.Done():
+		return value, ctx.Err()
+	}
+}
+
+// TryGet returns the result of the task without waiting
+// ok is false if the future is not resolved yet
+func (self *Future[R]) TryGet() (value R, ok bool, err error) {
+	if atomic.LoadUint32(&self.resolved) == 1 {
+		return self.value, true, self.err
+	}
+	return
+}
@@ -0,0 +1,35 @@
+package itogami
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSubmitFuture(t *testing.T) {
+	p := NewPool(2)
+	defer p.Release()
+	gate := make(chan struct{})
+	f := SubmitFuture(p, func() (int, error) {
+		<-gate
+		return 42, nil
+	})
+	if _, ok, _ := f.TryGet(); ok {
+		t.Fatal("TryGet resolved a pending future")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := f.GetContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("GetContext on a pending future = %v, want %v", err, context.DeadlineExceeded)
+	}
+	close(gate)
+	<-f.Done()
+	if v, ok, err := f.TryGet(); !ok || v != 42 || err != nil {
+		t.Fatalf("TryGet = %d, %t, %v", v, ok, err)
+	}
+	// waiting on an already resolved future does not block
+	if v, err := f.Get(); v != 42 || err != nil {
+		t.Fatalf("Get = %d, %v", v, err)
+	}
+	<-f.Done()
+}
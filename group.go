@@ -0,0 +1,79 @@
+package itogami
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+)
+
+// Group is a collection of tasks running on a shared Pool which can be waited upon together
+// similar to errgroup but bounded by the pool capacity instead of a per group limit
+// so that many independent groups can share the same pool
+type Group struct {
+	pool   *Pool
+	wg     sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+	once   sync.Once
+	err    error
+}
+
+// Group returns a new task group running on the pool
+// its context is derived from ctx and is cancelled on the first error returned by a task or when Wait returns
+func (self *Pool) Group(ctx context.Context) *Group {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Group{pool: self, ctx: ctx, cancel: cancel}
+}
+
+// Context returns the context of the group which tasks should observe for cancellation
+func (self *Group) Context() context.Context {
+	return self.ctx
+}
+
+// Go submits the task to the pool as part of the group
+// waits for an available worker until the group context is done, in which case the task is not run
+// and the context error is recorded as the group error unless an error was recorded before
+// a panicking task is recorded as a *PanicError and the panic is then propagated to the pool
+func (self *Group) Go(task func() error) {
+	if err := self.submit(task); err != nil {
+		self.fail(err)
+	}
+}
+
+// submit submits the task to the pool as part of the group like Go
+// but returns the submission error instead of recording it as the group error
+func (self *Group) submit(task func() error) error {
+	self.wg.Add(1)
+	err := self.pool.SubmitContext(self.ctx, func() {
+		defer self.wg.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				self.fail(&PanicError{Value: r, Stack: debug.Stack()})
+				panic(r)
+			}
+		}()
+		if err := task(); err != nil {
+			self.fail(err)
+		}
+	})
+	if err != nil {
+		self.wg.Done()
+	}
+	return err
+}
+
+// Wait blocks until all tasks submitted to the group have finished
+// returns the first error recorded in the group, if any
+func (self *Group) Wait() error {
+	self.wg.Wait()
+	self.cancel()
+	return self.err
+}
+
+// fail records the first error of the group and cancels its context
+func (self *Group) fail(err error) {
+	self.once.Do(func() {
+		self.err = err
+		self.cancel()
+	})
+}
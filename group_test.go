@@ -0,0 +1,24 @@
+package itogami
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestGroupFirstErrorCancels(t *testing.T) {
+	p := NewPool(4)
+	defer p.Release()
+	errFirst := errors.New("first")
+	g := p.Group(context.Background())
+	g.Go(func() error { return errFirst })
+	for i := 0; i < 3; i++ {
+		g.Go(func() error {
+			<-g.Context().Done()
+			return g.Context().Err()
+		})
+	}
+	if err := g.Wait(); err != errFirst {
+		t.Fatalf("Wait = %v, want %v", err, errFirst)
+	}
+}
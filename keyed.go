@@ -0,0 +1,206 @@
+package itogami
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// KeyedPool runs tasks sharing a key one at a time in submission order on top of a Pool
+// while tasks with different keys run in parallel across the pool
+// the tasks of a key run back to back on a single worker until there are none left for that key
+type KeyedPool[K comparable] struct {
+	pool *Pool
+	// queues of the keys having tasks in flight
+	keys sync.Map
+}
+
+// a single task in the queue of a key
+type keyedTask struct {
+	next atomic.Pointer[keyedTask]
+	task func()
+}
+
+// states of a key queue
+const (
+	keyIdle uint32 = iota
+	// claimed by the submitter dispatching the key to the pool, other submitters wait for the outcome
+	keyDispatching
+	// a worker of the pool has been handed the queue and runs the key until it is retired
+	keyDispatched
+)
+
+// lock-free multi-producer single-consumer queue of the tasks of a key
+// Credits -> https://www.1024cores.net/home/lock-free-algorithms/queues/non-intrusive-mpsc-node-based-queue
+type keyQueue struct {
+	// number of tasks of the key which are queued or running, -1 once the queue is retired
+	pending int64
+	// state of the dispatch of the key to the pool, one of the key states
+	running uint32
+	// last pushed task, swapped by the submitters
+	head atomic.Pointer[keyedTask]
+	// last popped task, only accessed by the worker running the key
+	tail *keyedTask
+}
+
+// NewKeyedPool returns a new KeyedPool dispatching the tasks to the given pool
+func NewKeyedPool[K comparable](pool *Pool) *KeyedPool[K] {
+	return &KeyedPool[K]{pool: pool}
+}
+
+// SubmitKeyed submits a new task to be run after all the tasks previously submitted with the same key have finished
+// the first task of an idle key is submitted to the pool like Submit and the following ones are dispatched
+// by the same worker as the tasks before them complete
+// returns ErrPoolClosed if the pool has been released or the error of the pool if it rejects the task dispatching the key
+// in which case the task is withdrawn, a task submitted while the key is being dispatched waits for the outcome and
+// dispatches the key itself if it was rejected so that every task either runs or has its submission fail
+func (self *KeyedPool[K]) SubmitKeyed(key K, task func()) error {
+	if atomic.LoadUint32(&self.pool.state) != poolOpen {
+		return ErrPoolClosed
+	}
+	q := self.acquire(key)
+	t := &keyedTask{task: task}
+	q.push(t)
+	for {
+		switch atomic.LoadUint32(&q.running) {
+		case keyDispatched:
+			// the worker running the key picks up the task once the tasks before it are done
+			return nil
+		case keyIdle:
+			if atomic.CompareAndSwapUint32(&q.running, keyIdle, keyDispatching) {
+				return self.dispatch(key, q, t)
+			}
+		default:
+			runtime.Gosched()
+		}
+	}
+}
+
+// dispatch submits a worker running the key to the pool on behalf of the task
+// if the pool rejects it, the task is withdrawn and the key is left idle for the next submitter
+func (self *KeyedPool[K]) dispatch(key K, q *keyQueue, t *keyedTask) error {
+	err := self.pool.Submit(func() { self.run(key, q) })
+	if err != nil {
+		// no worker is running the key, so the task can be withdrawn safely and is skipped by the next worker
+		t.task = nil
+		self.discard(key, q)
+		atomic.StoreUint32(&q.running, keyIdle)
+		return err
+	}
+	atomic.StoreUint32(&q.running, keyDispatched)
+	return nil
+}
+
+// discard drops the withdrawn tasks at the front of the queue so that a key left with withdrawn tasks only
+// is retired instead of staying around, must only be called by the submitter dispatching the key
+func (self *KeyedPool[K]) discard(key K, q *keyQueue) {
+	for q.withdrawn() {
+		q.pop()
+		if !self.release(key, q) {
+			return
+		}
+	}
+}
+
+// acquire reserves a place in the queue of the key, creating the queue if the key has no tasks in flight
+func (self *KeyedPool[K]) acquire(key K) *keyQueue {
+	for {
+		v, ok := self.keys.Load(key)
+		if !ok {
+			v, _ = self.keys.LoadOrStore(key, newKeyQueue())
+		}
+		q := v.(*keyQueue)
+		for n := atomic.LoadInt64(&q.pending); n >= 0; n = atomic.LoadInt64(&q.pending) {
+			if atomic.CompareAndSwapInt64(&q.pending, n, n+1) {
+				return q
+			}
+		}
+		// the queue is being retired by its worker and is about to be removed
+		runtime.Gosched()
+	}
+}
+
+// run executes the tasks of the key one after another until there are none left
+func (self *KeyedPool[K]) run(key K, q *keyQueue) {
+	// the pool accounts for the worker it dispatched, which covers the first task run by it
+	dispatched := true
+	for {
+		// tasks withdrawn by their submitter are skipped
+		if task := q.pop(); task != nil {
+			// the following tasks are not submitted to the pool but still count against its rate limit
+			if !dispatched && self.pool.limit != nil {
+				self.pool.limit.wait(nil, false, &self.pool.stats)
+			}
+			self.exec(task, !dispatched)
+			dispatched = false
+		}
+		if !self.release(key, q) {
+			return
+		}
+	}
+}
+
+// exec runs a task of the key, a panicking task is recovered and reported by the pool
+// so that the following tasks of the key still get to run
+// the tasks run without being submitted to the pool are counted in its stats if count is set
+func (self *KeyedPool[K]) exec(task func(), count bool) {
+	if count {
+		atomic.AddUint64(&self.pool.stats.submitted, 1)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			atomic.AddUint64(&self.pool.stats.panics, 1)
+			self.pool.opts.handlePanic(r)
+		}
+		if count {
+			atomic.AddUint64(&self.pool.stats.completed, 1)
+		}
+	}()
+	task()
+}
+
+// release accounts for a finished task of the key, returns true if there are more tasks to run
+// the queue is retired and removed once its last task has finished
+func (self *KeyedPool[K]) release(key K, q *keyQueue) bool {
+	for {
+		if n := atomic.LoadInt64(&q.pending); n > 1 {
+			if atomic.CompareAndSwapInt64(&q.pending, n, n-1) {
+				return true
+			}
+		} else if atomic.CompareAndSwapInt64(&q.pending, 1, -1) {
+			self.keys.Delete(key)
+			return false
+		}
+	}
+}
+
+// newKeyQueue returns a new empty queue
+func newKeyQueue() *keyQueue {
+	stub := new(keyedTask)
+	q := &keyQueue{tail: stub}
+	q.head.Store(stub)
+	return q
+}
+
+// push appends a task at the end of the queue
+func (self *keyQueue) push(t *keyedTask) {
+	self.head.Swap(t).next.Store(t)
+}
+
+// withdrawn reports whether the task at the front of the queue has been withdrawn by its submitter
+func (self *keyQueue) withdrawn() bool {
+	next := self.tail.next.Load()
+	return next != nil && next.task == nil
+}
+
+// pop removes the task at the front of the queue, a place must have been reserved for it beforehand
+// waits for a concurrent push which reserved its place but is yet to link its task
+func (self *keyQueue) pop() (task func()) {
+	next := self.tail.next.Load()
+	for ; next == nil; next = self.tail.next.Load() {
+		runtime.Gosched()
+	}
+	task, next.task = next.task, nil
+	self.tail = next
+	return
+}
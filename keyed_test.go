@@ -0,0 +1,137 @@
+package itogami
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestKeyedPoolRunsTasksOfAKeyInOrder(t *testing.T) {
+	const keys, submitters, tasks = 8, 4, 500
+	p := NewPool(4)
+	k := NewKeyedPool[int](p)
+
+	var mu sync.Mutex
+	// last sequence number run per key and submitter
+	last := make(map[[2]int]int)
+	var wg sync.WaitGroup
+	for g := 0; g < submitters; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < tasks; i++ {
+				key, seq := i%keys, i
+				if err := k.SubmitKeyed(key, func() {
+					mu.Lock()
+					defer mu.Unlock()
+					id := [2]int{key, g}
+					if prev, ok := last[id]; ok && prev >= seq {
+						t.Errorf("key %d: task %d of submitter %d ran after task %d", key, seq, g, prev)
+					}
+					last[id] = seq
+				}); err != nil {
+					t.Error(err)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if s := p.Stats(); s.Submitted != submitters*tasks || s.Completed != submitters*tasks {
+		t.Fatalf("stats count %d submitted and %d completed tasks, want %d", s.Submitted, s.Completed, submitters*tasks)
+	}
+}
+
+func TestKeyedPoolRunsOneTaskOfAKeyAtOnce(t *testing.T) {
+	p := NewPool(8)
+	defer p.Release()
+	k := NewKeyedPool[string](p)
+
+	var mu sync.Mutex
+	running := 0
+	var wg sync.WaitGroup
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go k.SubmitKeyed("key", func() {
+			defer wg.Done()
+			mu.Lock()
+			running++
+			if running > 1 {
+				t.Error("tasks of the same key overlapped")
+			}
+			mu.Unlock()
+			runtime.Gosched()
+			mu.Lock()
+			running--
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+}
+
+func TestKeyedPoolRejectedDispatch(t *testing.T) {
+	p, err := NewPoolWithOptions(1, WithNonblocking(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := NewKeyedPool[int](p)
+	release := occupy(t, p, 1)
+
+	ran := false
+	if err := k.SubmitKeyed(1, func() { ran = true }); err != ErrPoolOverload {
+		t.Fatalf("SubmitKeyed on a saturated pool = %v, want %v", err, ErrPoolOverload)
+	}
+	if ran {
+		t.Fatal("rejected task ran in the submitter")
+	}
+	if _, ok := k.keys.Load(1); ok {
+		t.Fatal("key left with a withdrawn task only was not retired")
+	}
+	release()
+
+	// the next task of the key dispatches the queue while the rejected task stays withdrawn
+	var wg sync.WaitGroup
+	wg.Add(1)
+	waitFor(t, "the key to be dispatched", func() bool { return k.SubmitKeyed(1, wg.Done) == nil })
+	wg.Wait()
+	if ran {
+		t.Fatal("rejected task ran after all")
+	}
+
+	p.Release()
+	if err := k.SubmitKeyed(1, func() {}); err != ErrPoolClosed {
+		t.Fatalf("SubmitKeyed after Release = %v, want %v", err, ErrPoolClosed)
+	}
+}
+
+func TestKeyedPoolSubmitDuringRejectedDispatch(t *testing.T) {
+	p := NewPool(1)
+	k := NewKeyedPool[int](p)
+	release := occupy(t, p, 1)
+	defer release()
+
+	// the first submitter blocks on the saturated pool while dispatching the key
+	errs := make(chan error, 2)
+	go func() { errs <- k.SubmitKeyed(1, func() {}) }()
+	waitFor(t, "the first submitter to block", func() bool { return p.Stats().Blocking == 1 })
+	go func() { errs <- k.SubmitKeyed(1, func() {}) }()
+	waitFor(t, "the second task to be queued", func() bool {
+		v, ok := k.keys.Load(1)
+		return ok && atomic.LoadInt64(&v.(*keyQueue).pending) == 2
+	})
+
+	// the task submitted meanwhile must not be stranded once the dispatch is rejected
+	p.Release()
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != ErrPoolClosed {
+			t.Fatalf("SubmitKeyed while the dispatch was rejected = %v, want %v", err, ErrPoolClosed)
+		}
+	}
+	if _, ok := k.keys.Load(1); ok {
+		t.Fatal("key left with withdrawn tasks only was not retired")
+	}
+}
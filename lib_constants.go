@@ -0,0 +1,10 @@
+package itogami
+
+import "github.com/alphadose/itogami/constants"
+
+const (
+	cacheLinePadSize          = constants.CacheLinePadSize
+	uint64SubtractionConstant = ^uint64(0)
+)
+
+type cacheLinePadding struct{ _ [cacheLinePadSize]byte }
@@ -0,0 +1,38 @@
+package itogami
+
+import "sync/atomic"
+
+// chanParker parks and readies a worker goroutine using a per-slot channel
+// used by the portable build and as a fallback whenever the runtime linkage fails its self-check
+type chanParker struct {
+	signal chan struct{}
+	// set while the worker goroutine is blocked on the channel
+	waiting uint32
+}
+
+// bind prepares the parker, must be called by the worker goroutine before it is parked for the first time
+func (self *chanParker) bind() {
+	self.signal = make(chan struct{}, 1)
+}
+
+// park blocks the worker goroutine until it is readied
+func (self *chanParker) park() {
+	select {
+	case <-self.signal:
+		return
+	default:
+	}
+	atomic.StoreUint32(&self.waiting, 1)
+	<-self.signal
+	atomic.StoreUint32(&self.waiting, 0)
+}
+
+// ready wakes up the worker goroutine, if it is not parked yet then its next park returns immediately
+func (self *chanParker) ready() {
+	self.signal <- struct{}{}
+}
+
+// parked reports whether the worker goroutine is blocked on the channel waiting to be readied
+func (self *chanParker) parked() bool {
+	return atomic.LoadUint32(&self.waiting) == 1
+}
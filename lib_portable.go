@@ -0,0 +1,24 @@
+//go:build (go1.23 && !itogami_linkname) || itogami_portable || race
+
+package itogami
+
+import "time"
+
+// Portable implementation of the scheduling primitives which does not link against golang internal runtime library
+// Selected with the itogami_portable build tag, for race builds and from Go 1.23 onwards where the linker
+// restricts go:linkname references into the runtime, the linked implementation can still be forced
+// on newer Go versions with the itogami_linkname build tag along with -ldflags=-checklinkname=0
+
+// parker parks and readies a worker goroutine using a per-slot channel
+type parker = chanParker
+
+// reference point for nanotime
+var epoch = time.Now()
+
+// nanotime returns the monotonic time in nanoseconds
+func nanotime() int64 {
+	return int64(time.Since(epoch))
+}
+
+// linkRuntime is a no-op as there is no runtime linkage to check
+func linkRuntime() {}
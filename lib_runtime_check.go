@@ -0,0 +1,76 @@
+//go:build (!go1.23 || itogami_linkname) && !itogami_portable && !race
+
+package itogami
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// maximum time the self-check waits for the probe goroutine at every step
+const runtimeCheckTimeout = time.Second
+
+var (
+	// whether the runtime linkage passed its self-check and the fast path can be used, set by linkRuntime
+	runtimeLinked bool
+	linkOnce      sync.Once
+	// self-check run by linkRuntime, replaced in tests to exercise the fallback
+	runtimeProbe = runtimeCheck
+)
+
+// linkRuntime runs the self-check once the first pool is constructed instead of at package init
+// so that importing the package alone does not spawn the probe goroutine
+func linkRuntime() {
+	linkOnce.Do(func() {
+		runtimeLinked = runtimeProbe()
+	})
+}
+
+// runtimeCheck validates the behaviour of the linked runtime internals before they are used by any pool
+// the goroutine status constants and the parking flow were copied from Go 1.19 and the offsets used by GetG
+// are specific to every architecture, so a probe goroutine is parked via gopark and readied via goready
+// while verifying its status at every step, any mismatch makes the pools fall back to the channel based parker
+// instead of corrupting the scheduler
+func runtimeCheck() bool {
+	// GetG must point to a running goroutine before the probe relies on it
+	if gp := GetG(); gp == nil || Readgstatus(gp)&^_Gscan != _Grunning {
+		return false
+	}
+	var (
+		probe unsafe.Pointer
+		state uint32
+		woken = make(chan struct{})
+	)
+	go func() {
+		gp := GetG()
+		if Readgstatus(gp)&^_Gscan != _Grunning {
+			return
+		}
+		atomic.StorePointer(&probe, gp)
+		gopark(parkCommit, unsafe.Pointer(&state), waitReasonZero, traceEvNone, 1)
+		close(woken)
+	}()
+	// wait for the probe goroutine to be parked
+	deadline := time.Now().Add(runtimeCheckTimeout)
+	for atomic.LoadUint32(&state) != parkerParked {
+		if time.Now().After(deadline) {
+			return false
+		}
+		runtime.Gosched()
+	}
+	gp := atomic.LoadPointer(&probe)
+	if Readgstatus(gp)&^_Gscan != _Gwaiting {
+		return false
+	}
+	atomic.StoreUint32(&state, parkerRunning)
+	goready(gp, 1)
+	select {
+	case <-woken:
+		return true
+	case <-time.After(runtimeCheckTimeout):
+		return false
+	}
+}
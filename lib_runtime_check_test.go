@@ -0,0 +1,36 @@
+//go:build (!go1.23 || itogami_linkname) && !itogami_portable && !race
+
+package itogami
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRuntimeCheckFallback(t *testing.T) {
+	linkRuntime()
+	linked, probe := runtimeLinked, runtimeProbe
+	// the once is used up by the pool below, so the outcome of the actual self-check sticks once restored
+	defer func() { runtimeLinked, runtimeProbe = linked, probe }()
+
+	// a failing self-check makes the pools fall back to the channel based parker
+	linkOnce, runtimeProbe = sync.Once{}, func() bool { return false }
+	p := NewPool(4)
+	if runtimeLinked {
+		t.Fatal("runtime linkage used although its self-check failed")
+	}
+	var ran int64
+	for i := 0; i < 100; i++ {
+		if err := p.Submit(func() { atomic.AddInt64(&ran, 1) }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if ran != 100 {
+		t.Fatalf("%d tasks ran on the fallback parker, want 100", ran)
+	}
+}
@@ -1,20 +1,14 @@
+//go:build (!go1.23 || itogami_linkname) && !itogami_portable && !race
+
 package itogami
 
 import (
 	"runtime"
+	"sync/atomic"
 	"unsafe"
 	_ "unsafe"
-
-	"github.com/alphadose/itogami/constants"
 )
 
-const (
-	cacheLinePadSize          = constants.CacheLinePadSize
-	uint64SubtractionConstant = ^uint64(0)
-)
-
-type cacheLinePadding struct{ _ [cacheLinePadSize]byte }
-
 // Linking ZenQ with golang internal runtime library to allow usage of scheduling primitives
 // like goready(), mcall() etc to allow low-level scheduling of goroutines
 
@@ -146,22 +140,74 @@ func ProcPin() int
 //go:linkname ProcUnpin runtime.procUnpin
 func ProcUnpin()
 
-// custom parking function
-func fast_park(gp unsafe.Pointer) {
-	dropg()
-	casgstatus(gp, _Grunning, _Gwaiting)
-	schedule()
-}
-
 // whether the system has multiple cores or a single core
 var multicore = runtime.NumCPU() > 1
 
-// call ready after ensuring the goroutine is parked
-func safe_ready(gp unsafe.Pointer) {
-	for Readgstatus(gp)&^_Gscan != _Gwaiting {
-		mcall(gosched_m)
+// states of a parker
+const (
+	parkerRunning uint32 = iota
+	// the parker was readied before its goroutine parked, the next park returns immediately
+	parkerReadied
+	parkerParked
+)
+
+// parkCommit runs on the system stack once the goroutine status is _Gwaiting and commits the park
+// aborts it consuming the token if the parker was readied meanwhile, gopark then resumes the goroutine right away
+//go:nosplit
+func parkCommit(gp, state unsafe.Pointer) bool {
+	if atomic.CompareAndSwapUint32((*uint32)(state), parkerRunning, parkerParked) {
+		return true
+	}
+	atomic.StoreUint32((*uint32)(state), parkerRunning)
+	return false
+}
+
+// parker parks and readies a worker goroutine directly via the runtime scheduler
+// falls back to a channel if the runtime linkage failed its self-check
+// the state handshake makes sure only a goroutine parked by the parker itself is readied, its status alone
+// can not tell as the runtime also moves a running goroutine to _Gwaiting for a while, e.g. during a GC assist
+type parker struct {
+	threadPtr unsafe.Pointer
+	state     uint32
+	chanParker
+}
+
+// bind stores the pointer to the current goroutine, must be called by the worker goroutine itself
+func (self *parker) bind() {
+	if runtimeLinked {
+		self.threadPtr = GetG()
+	} else {
+		self.chanParker.bind()
+	}
+}
+
+// park parks the bound goroutine until it is readied
+func (self *parker) park() {
+	if !runtimeLinked {
+		self.chanParker.park()
+	} else if !atomic.CompareAndSwapUint32(&self.state, parkerReadied, parkerRunning) {
+		// the trace argument is a block reason from Go 1.22 onwards where 0 stands for an unspecified one
+		gopark(parkCommit, unsafe.Pointer(&self.state), waitReasonZero, traceEvNone, 1)
+	}
+}
+
+// ready wakes up the bound goroutine, if it is not parked yet then its next park returns immediately
+func (self *parker) ready() {
+	if !runtimeLinked {
+		self.chanParker.ready()
+	} else if !atomic.CompareAndSwapUint32(&self.state, parkerRunning, parkerReadied) {
+		// the goroutine is committed to its park
+		atomic.StoreUint32(&self.state, parkerRunning)
+		goready(self.threadPtr, 1)
+	}
+}
+
+// parked reports whether the bound goroutine has been parked and is yet to be readied
+func (self *parker) parked() bool {
+	if !runtimeLinked {
+		return self.chanParker.parked()
 	}
-	goready(gp, 1)
+	return atomic.LoadUint32(&self.state) == parkerParked
 }
 
 type waitReason uint8
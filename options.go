@@ -0,0 +1,185 @@
+package itogami
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"runtime/debug"
+	"time"
+)
+
+// Option represents a functional option for configuring a pool
+type Option func(*options)
+
+// Logger is used by a pool for reporting events like recovered panics
+type Logger interface {
+	Printf(format string, args ...any)
+}
+
+// logger used by pools which were not configured with one
+var defaultLogger Logger = log.New(os.Stderr, "", log.LstdFlags)
+
+// options holds the configuration shared by Pool and PoolWithFunc
+type options struct {
+	// invoked with the recovered value whenever a task panics
+	panicHandler func(any)
+	// invoked whenever a task submitted with a timeout is still running past it
+	timeoutHandler func()
+	// capacity of the pending task queue, zero disables the queue
+	queueSize uint64
+	// submissions fail with ErrPoolOverload instead of waiting when the pool is full
+	nonblocking bool
+	// workers parked for longer than this are retired, zero keeps them forever
+	expiry time.Duration
+	// number of workers spawned at construction
+	preSpawn uint64
+	// maximum number of submitters allowed to wait for a worker at once, zero means no limit
+	maxBlocking uint64
+	// maximum number of task starts per second along with the bursts allowed, zero means no limit
+	rate  float64
+	burst uint64
+	// results are delivered on a channel with this buffer instead of futures, only used by PoolWithResult
+	results      bool
+	resultBuffer uint64
+	logger       Logger
+	// identifies the pool in logs
+	name string
+}
+
+// loadOptions applies all the given options over the defaults and validates the resulting configuration
+// for a pool of the given size
+func loadOptions(size uint64, opts []Option) (o options, err error) {
+	for _, opt := range opts {
+		opt(&o)
+	}
+	switch {
+	case size == 0:
+		err = ErrInvalidPoolSize
+	case o.expiry < 0:
+		err = fmt.Errorf("%w: negative expiry duration %s", ErrInvalidOptions, o.expiry)
+	case o.preSpawn > size:
+		err = fmt.Errorf("%w: pre-spawn count %d exceeds the pool size %d", ErrInvalidOptions, o.preSpawn, size)
+	case o.nonblocking && o.maxBlocking > 0:
+		err = fmt.Errorf("%w: a non-blocking pool cannot have blocking submitters", ErrInvalidOptions)
+	case o.rate < 0 || o.rate != o.rate:
+		err = fmt.Errorf("%w: invalid rate limit %v", ErrInvalidOptions, o.rate)
+	case o.rate > 0 && o.burst == 0:
+		err = fmt.Errorf("%w: rate limit burst must be greater than zero", ErrInvalidOptions)
+	}
+	return
+}
+
+// WithPanicHandler sets the handler which is invoked with the recovered value whenever a task panics
+// the handler runs on the worker goroutine before it is returned to the pool, hence runtime/debug.Stack()
+// called inside the handler still points to the panicking task
+// if no handler is set, the panic value along with the stack trace is logged
+func WithPanicHandler(handler func(any)) Option {
+	return func(o *options) {
+		o.panicHandler = handler
+	}
+}
+
+// WithTimeoutHandler sets the handler which is invoked whenever a task submitted via SubmitWithTimeout
+// runs past its timeout, the handler is invoked once per such task as soon as the timeout passes
+func WithTimeoutHandler(handler func()) Option {
+	return func(o *options) {
+		o.timeoutHandler = handler
+	}
+}
+
+// WithTaskQueue attaches a bounded queue of the given capacity for every priority level to a Pool
+// once all workers are busy, submitted tasks are held in this queue and are picked up by
+// workers as they finish their current task instead of the submitter waiting for a worker
+// the submitter waits only when this queue is full, unless the pool is non-blocking
+// not supported by PoolWithFunc
+func WithTaskQueue(size uint64) Option {
+	return func(o *options) {
+		o.queueSize = size
+	}
+}
+
+// WithNonblocking makes submissions return ErrPoolOverload immediately instead of
+// waiting for an available worker when the pool ( and its task queue if any ) is full
+func WithNonblocking(nonblocking bool) Option {
+	return func(o *options) {
+		o.nonblocking = nonblocking
+	}
+}
+
+// WithExpiryDuration retires workers which have been parked for longer than the given duration
+// a background reaper scans the stack of parked workers at this interval and lets the expired ones exit
+// so that the goroutines and their stacks are not kept around forever after a burst
+func WithExpiryDuration(expiry time.Duration) Option {
+	return func(o *options) {
+		o.expiry = expiry
+	}
+}
+
+// WithPreSpawn warms up the pool at construction with the given number of parked workers
+// so that the first submissions do not pay for spawning goroutines, see Pool.Warm
+func WithPreSpawn(n uint64) Option {
+	return func(o *options) {
+		o.preSpawn = n
+	}
+}
+
+// WithMaxBlockingTasks limits the number of submitters which can wait for an available worker at once
+// once the limit is reached, further submissions return ErrPoolOverload immediately, zero means no limit
+func WithMaxBlockingTasks(n uint64) Option {
+	return func(o *options) {
+		o.maxBlocking = n
+	}
+}
+
+// WithRateLimit limits the number of tasks started per second, allowing bursts of up to burst tasks at once
+// submitters exceeding the limit wait for their turn, or get ErrRateLimited if the pool is non-blocking
+// whereas tasks held in the task queue wait for their turn once a worker picks them up
+// rejected submissions do not count against the limit, a rate of zero means no limit
+func WithRateLimit(rate float64, burst uint64) Option {
+	return func(o *options) {
+		o.rate = rate
+		o.burst = burst
+	}
+}
+
+// WithResults makes a PoolWithResult deliver the results of the values passed to Send on a channel
+// with the given buffer instead of returning a future for every value, see PoolWithResult.Results
+// a full channel makes the workers wait for the consumer, not supported by Pool and PoolWithFunc
+func WithResults(buffer uint64) Option {
+	return func(o *options) {
+		o.results = true
+		o.resultBuffer = buffer
+	}
+}
+
+// WithLogger sets the logger used for reporting recovered panics when there is no panic handler
+func WithLogger(logger Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithName sets a name identifying the pool in logs
+func WithName(name string) Option {
+	return func(o *options) {
+		o.name = name
+	}
+}
+
+// handlePanic reports a value recovered from a panicking task
+// must be called from the deferred function of the worker so that the stack trace is preserved
+func (self *options) handlePanic(r any) {
+	if self.panicHandler != nil {
+		self.panicHandler(r)
+		return
+	}
+	logger := self.logger
+	if logger == nil {
+		logger = defaultLogger
+	}
+	if self.name != "" {
+		logger.Printf("itogami: worker of pool %s recovered from panic: %v\n%s", self.name, r, debug.Stack())
+	} else {
+		logger.Printf("itogami: worker recovered from panic: %v\n%s", r, debug.Stack())
+	}
+}
@@ -0,0 +1,89 @@
+package itogami
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// ForEach calls fn for every item of the slice in parallel on the pool and waits for all calls to finish
+// the items are split into chunks claimed by up to as many tasks as the pool capacity, the chunks shrink
+// as the remaining items run out so that the tasks finish at about the same time
+// on a pool which rejects some of these tasks, for instance a non-blocking one shared with other work,
+// the items are processed by the tasks which could be started
+// the context passed to fn is cancelled on the first error, after which no further items are processed
+// returns the first error returned by fn, a *PanicError if fn panicked or the context error
+func ForEach[T any](ctx context.Context, p *Pool, items []T, fn func(context.Context, T) error) error {
+	return parallel(ctx, p, len(items), func(ctx context.Context, i int) error {
+		return fn(ctx, items[i])
+	})
+}
+
+// Map calls fn for every item of the slice in parallel on the pool like ForEach
+// and returns the results in the order of the items, or nil along with the first error
+func Map[T, R any](ctx context.Context, p *Pool, items []T, fn func(context.Context, T) (R, error)) ([]R, error) {
+	results := make([]R, len(items))
+	err := parallel(ctx, p, len(items), func(ctx context.Context, i int) (err error) {
+		results[i], err = fn(ctx, items[i])
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// parallel calls fn for every index below n using a task group on the pool
+// every task keeps claiming chunks of indices until there are none left, hence once a task is running
+// the pool rejecting further tasks for being saturated only means that fewer tasks share the work
+func parallel(ctx context.Context, p *Pool, n int, fn func(context.Context, int) error) error {
+	tasks := n
+	if size := atomic.LoadUint64(&p.maxSize); uint64(tasks) > size {
+		tasks = int(size)
+	}
+	var (
+		next  int64
+		group = p.Group(ctx)
+	)
+	work := func() error {
+		for {
+			start, end := claim(&next, n, tasks)
+			if start >= end {
+				return nil
+			} else if err := group.ctx.Err(); err != nil {
+				return err
+			}
+			for i := start; i < end; i++ {
+				if err := fn(group.ctx, i); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for t := 0; t < tasks; t++ {
+		if err := group.submit(work); err != nil {
+			if t == 0 || (err != ErrPoolOverload && err != ErrRateLimited) {
+				group.fail(err)
+			}
+			break
+		}
+	}
+	return group.Wait()
+}
+
+// claim claims the next chunk of indices below n, a chunk covers a share of the remaining indices
+// for every one of the tasks so that the chunks get smaller towards the end, returns an empty range once done
+func claim(next *int64, n, tasks int) (start, end int) {
+	for {
+		curr := atomic.LoadInt64(next)
+		if curr >= int64(n) {
+			return n, n
+		}
+		size := (int64(n) - curr) / int64(2*tasks)
+		if size < 1 {
+			size = 1
+		}
+		if atomic.CompareAndSwapInt64(next, curr, curr+size) {
+			return int(curr), int(curr + size)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package itogami
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMapPreservesOrder(t *testing.T) {
+	p := NewPool(4)
+	defer p.Release()
+	items := make([]int, 1000)
+	for i := range items {
+		items[i] = i
+	}
+	results, err := Map(context.Background(), p, items, func(_ context.Context, i int) (int, error) {
+		return i * 2, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, r := range results {
+		if r != i*2 {
+			t.Fatalf("results[%d] = %d, want %d", i, r, i*2)
+		}
+	}
+}
+
+func TestForEachFirstErrorStops(t *testing.T) {
+	p := NewPool(4)
+	defer p.Release()
+	errStop := errors.New("stop")
+	items := make([]int, 10000)
+	for i := range items {
+		items[i] = i
+	}
+	var processed int64
+	err := ForEach(context.Background(), p, items, func(_ context.Context, i int) error {
+		atomic.AddInt64(&processed, 1)
+		if i == 0 {
+			return errStop
+		}
+		return nil
+	})
+	if err != errStop {
+		t.Fatalf("ForEach = %v, want %v", err, errStop)
+	}
+	if n := atomic.LoadInt64(&processed); n == int64(len(items)) {
+		t.Fatal("ForEach kept processing items after the first error")
+	}
+}
+
+func TestMapSharedNonblockingPool(t *testing.T) {
+	p, err := NewPoolWithOptions(4, WithNonblocking(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release()
+	gate := make(chan struct{})
+	defer close(gate)
+	if err := p.Submit(func() { <-gate }); err != nil {
+		t.Fatal(err)
+	}
+
+	items := make([]int, 1000)
+	for i := range items {
+		items[i] = i
+	}
+	results, err := Map(context.Background(), p, items, func(_ context.Context, i int) (int, error) {
+		return i * 2, nil
+	})
+	if err != nil {
+		t.Fatalf("Map on a partially busy pool: %v", err)
+	}
+	for i, r := range results {
+		if r != i*2 {
+			t.Fatalf("results[%d] = %d, want %d", i, r, i*2)
+		}
+	}
+}
+
+func TestForEachSaturatedNonblockingPool(t *testing.T) {
+	p, err := NewPoolWithOptions(2, WithNonblocking(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release()
+	gate := make(chan struct{})
+	defer close(gate)
+	for i := 0; i < 2; i++ {
+		if err := p.Submit(func() { <-gate }); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = ForEach(context.Background(), p, []int{1, 2, 3}, func(context.Context, int) error { return nil })
+	if err != ErrPoolOverload {
+		t.Fatalf("ForEach on a saturated pool = %v, want %v", err, ErrPoolOverload)
+	}
+}
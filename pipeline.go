@@ -0,0 +1,158 @@
+package itogami
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+)
+
+// Pipeline is a chain of stages where every stage processes its items on its own PoolWithFunc
+// stages are connected by bounded buffers so that a slow stage makes the stages before it wait
+// all the way up to the callers of Send on the first stage
+type Pipeline struct {
+	ctx context.Context
+	mu  sync.Mutex
+	// shut down the stages in the order they were added
+	closers []func()
+	errs    PipelineError
+	once    sync.Once
+}
+
+// Stage is a single stage of a Pipeline transforming every input item into an output item with the given concurrency
+// a stage feeds either the next stage added via Then or the consumer of its Output
+type Stage[In, Out any] struct {
+	pipeline *Pipeline
+	// position of the stage in the pipeline
+	index int
+	pool  *PoolWithFunc[In]
+	out   chan Out
+	// closed once all the output of the previous stage has been handed to the stage, nil for a stage fed by Send
+	fed chan struct{}
+	// guards Send against Close
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewPipeline returns a new empty pipeline, the context is passed to all stages and stops the pipeline once done
+func NewPipeline(ctx context.Context) *Pipeline {
+	return &Pipeline{ctx: ctx}
+}
+
+// NewStage adds a new stage to the pipeline which is fed by Send, the stage runs up to concurrency calls of fn at once
+// on a PoolWithFunc configured with the given options and buffers up to buffer output items
+// an item for which fn returns an error is dropped and the error is reported by Close
+func NewStage[In, Out any](p *Pipeline, concurrency uint64, buffer int, fn func(context.Context, In) (Out, error), opts ...Option) (*Stage[In, Out], error) {
+	return newStage(p, nil, concurrency, buffer, fn, opts)
+}
+
+// Then adds a new stage to the pipeline which is fed by the output of the given stage, see NewStage
+func Then[In, Mid, Out any](prev *Stage[In, Mid], concurrency uint64, buffer int, fn func(context.Context, Mid) (Out, error), opts ...Option) (*Stage[Mid, Out], error) {
+	return newStage(prev.pipeline, prev.out, concurrency, buffer, fn, opts)
+}
+
+// newStage adds a new stage to the pipeline which is fed by the given buffer if not nil
+func newStage[In, Out any](p *Pipeline, in <-chan In, concurrency uint64, buffer int, fn func(context.Context, In) (Out, error), opts []Option) (*Stage[In, Out], error) {
+	s := &Stage[In, Out]{pipeline: p, out: make(chan Out, buffer)}
+	pool, err := NewPoolWithFuncOptions(concurrency, func(item In) { s.process(fn, item) }, opts...)
+	if err != nil {
+		return nil, err
+	}
+	s.pool = pool
+	p.mu.Lock()
+	s.index = len(p.closers)
+	p.closers = append(p.closers, s.close)
+	p.mu.Unlock()
+	if in != nil {
+		s.fed = make(chan struct{})
+		go s.feed(in)
+	}
+	return s, nil
+}
+
+// Send hands the item to the stage, waiting while the stage is saturated
+// returns ErrPoolClosed once the pipeline has been closed or the context error once the context of the pipeline is done
+func (self *Stage[In, Out]) Send(item In) error {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	if self.closed {
+		return ErrPoolClosed
+	}
+	return self.pool.InvokeContext(self.pipeline.ctx, item)
+}
+
+// Output returns the buffer holding the output items of the stage which is closed once the stage has been shut down
+// it must be consumed unless the stage is followed by another stage
+func (self *Stage[In, Out]) Output() <-chan Out {
+	return self.out
+}
+
+// process runs fn on a single item and hands the result to the output buffer
+func (self *Stage[In, Out]) process(fn func(context.Context, In) (Out, error), item In) {
+	ctx := self.pipeline.ctx
+	defer func() {
+		if r := recover(); r != nil {
+			self.pipeline.fail(self.index, item, &PanicError{Value: r, Stack: debug.Stack()})
+			panic(r)
+		}
+	}()
+	out, err := fn(ctx, item)
+	if err != nil {
+		self.pipeline.fail(self.index, item, err)
+		return
+	}
+	select {
+	case self.out <- out:
+	case <-ctx.Done():
+		self.pipeline.fail(self.index, item, ctx.Err())
+	}
+}
+
+// feed hands all items from the output of the previous stage to the stage until it is closed
+// items which cannot be handed over anymore are still drained so that the previous stage does not get stuck
+func (self *Stage[In, Out]) feed(in <-chan In) {
+	defer close(self.fed)
+	for item := range in {
+		if err := self.pool.InvokeContext(self.pipeline.ctx, item); err != nil {
+			self.pipeline.fail(self.index, item, err)
+		}
+	}
+}
+
+// close stops accepting new items, waits for the items in flight to be processed and closes the output buffer
+// a stage fed by the previous stage is shut down only after all the output of the previous stage has been handed to it
+func (self *Stage[In, Out]) close() {
+	if self.fed != nil {
+		<-self.fed
+	}
+	self.mu.Lock()
+	self.closed = true
+	self.mu.Unlock()
+	self.pool.Shutdown(context.Background())
+	close(self.out)
+}
+
+// Close shuts down the stages in the order they were added, every stage finishes processing its items
+// before the stages after it are shut down, returns a PipelineError holding the items which failed in any stage
+func (self *Pipeline) Close() error {
+	self.once.Do(func() {
+		self.mu.Lock()
+		closers := self.closers
+		self.mu.Unlock()
+		for _, shutdown := range closers {
+			shutdown()
+		}
+	})
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if len(self.errs) == 0 {
+		return nil
+	}
+	return self.errs
+}
+
+// fail records the error of an item in a stage
+func (self *Pipeline) fail(stage int, item any, err error) {
+	self.mu.Lock()
+	self.errs = append(self.errs, &ItemError{Stage: stage, Item: item, Err: err})
+	self.mu.Unlock()
+}
@@ -0,0 +1,136 @@
+package itogami
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPipelineStages(t *testing.T) {
+	errOdd := errors.New("odd")
+	p := NewPipeline(context.Background())
+	parse, err := NewStage(p, 4, 2, func(_ context.Context, s string) (int, error) {
+		return strconv.Atoi(s)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	double, err := Then(parse, 3, 2, func(_ context.Context, n int) (int, error) {
+		if n%2 != 0 {
+			return 0, errOdd
+		}
+		return 2 * n, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sum := make(chan int)
+	go func() {
+		total := 0
+		for n := range double.Output() {
+			total += n
+		}
+		sum <- total
+	}()
+	for i := 0; i < 100; i++ {
+		if err := parse.Send(strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := parse.Send("x"); err != nil {
+		t.Fatal(err)
+	}
+	err = p.Close()
+	if total := <-sum; total != 2*2450 {
+		t.Fatalf("output of the pipeline sums up to %d, want %d", total, 2*2450)
+	}
+
+	var perr PipelineError
+	if !errors.As(err, &perr) || len(perr) != 51 {
+		t.Fatalf("Close = %v, want the errors of 51 items", err)
+	}
+	if !errors.Is(err, errOdd) {
+		t.Fatalf("errors.Is(%v, errOdd) = false", err)
+	}
+	var numErr *strconv.NumError
+	if !errors.As(err, &numErr) {
+		t.Fatalf("errors.As(%v, *strconv.NumError) = false", err)
+	}
+	for _, item := range perr {
+		if errors.Is(item, errOdd) && item.Stage != 1 {
+			t.Fatalf("item %v failed in stage %d, want 1", item.Item, item.Stage)
+		}
+	}
+	if err := parse.Send("1"); err != ErrPoolClosed {
+		t.Fatalf("Send after Close = %v, want %v", err, ErrPoolClosed)
+	}
+}
+
+func TestPipelineErrorEmpty(t *testing.T) {
+	var perr PipelineError
+	if msg := perr.Error(); msg != "itogami: no pipeline items failed" {
+		t.Fatalf("Error of an empty PipelineError = %q", msg)
+	}
+	if errors.Is(perr, ErrPoolClosed) {
+		t.Fatal("empty PipelineError matches an unrelated error")
+	}
+}
+
+func TestPipelineBackpressure(t *testing.T) {
+	p := NewPipeline(context.Background())
+	first, _ := NewStage(p, 1, 1, func(_ context.Context, n int) (int, error) { return n, nil })
+	gate := make(chan struct{})
+	second, _ := Then(first, 1, 1, func(_ context.Context, n int) (int, error) {
+		<-gate
+		return n, nil
+	})
+
+	var sent int64
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			first.Send(i)
+			atomic.AddInt64(&sent, 1)
+		}
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt64(&sent); n > 10 {
+		t.Fatalf("%d items were sent into a stalled pipeline", n)
+	}
+	close(gate)
+	go func() {
+		for range second.Output() {
+		}
+	}()
+	<-done
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPipelineContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := NewPipeline(ctx)
+	processed := make(chan struct{})
+	stage, _ := NewStage(p, 1, 0, func(_ context.Context, n int) (int, error) {
+		close(processed)
+		return n, nil
+	})
+	// the output of the item is never consumed, hence the item fails once the context is cancelled
+	if err := stage.Send(0); err != nil {
+		t.Fatal(err)
+	}
+	<-processed
+	cancel()
+	if err := stage.Send(1); err != context.Canceled {
+		t.Fatalf("Send = %v, want %v", err, context.Canceled)
+	}
+	if err := p.Close(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Close = %v, want an item failed with %v", err, context.Canceled)
+	}
+}
@@ -1,15 +1,43 @@
 package itogami
 
 import (
-	"sync"
+	"context"
+	"fmt"
+	"runtime"
 	"sync/atomic"
+	"time"
 	"unsafe"
 )
 
+// states of a pool
+const (
+	poolOpen uint32 = iota
+	poolClosed
+	// closed and all workers have exited
+	poolTerminated
+)
+
+// worker count of a terminated pool, beyond any pool capacity so that no worker can be spawned anymore
+const terminatedSize uint64 = 1 << 63
+
 // a single slot for a worker in Pool
 type slot struct {
-	threadPtr unsafe.Pointer
-	task      func()
+	parker
+	task func()
+	// time at which the worker was last parked
+	lastUsed int64
+	// set when the worker is woken up only to exit
+	quit bool
+	// set until a pre-spawned worker has been parked for the first time, Warm waits for it meanwhile
+	// cleared by the worker once it is woken up or exits without parking in case Warm missed it parked
+	warming uint32
+}
+
+// warmed notifies Warm that a pre-spawned worker is done warming as it has been woken up or is exiting
+func (self *slot) warmed() {
+	if atomic.LoadUint32(&self.warming) != 0 {
+		atomic.StoreUint32(&self.warming, 0)
+	}
 }
 
 // Pool represents the thread-pool for performing any kind of task ( type -> func() {} )
@@ -17,64 +45,573 @@ type Pool struct {
 	currSize uint64
 	_p1      [cacheLinePadSize - unsafe.Sizeof(uint64(0))]byte
 	maxSize  uint64
-	_p2      [cacheLinePadSize - unsafe.Sizeof(uint64(0))]byte
+	state    uint32
+	_p2      [cacheLinePadSize - unsafe.Sizeof(uint64(0)) - unsafe.Sizeof(uint32(0))]byte
 	// using a stack keeps cpu caches warm based on FILO property
 	top atomic.Pointer[node]
 	_p3 [cacheLinePadSize - unsafe.Sizeof(atomic.Pointer[node]{})]byte
+	// pending tasks waiting for a worker for every priority level, nil if the pool has no task queue
+	tasks [priorityLevels]*queue[*pendingTask]
+	// submitters parked until a worker is available for every priority level
+	waiters [priorityLevels]waitList[func()]
+	// number of pending tasks taken by workers, used as the starvation guard for lower priorities
+	turns atomic.Uint64
+	// rate limit of task starts, nil if the pool is not rate limited
+	limit *limiter
+	// closed once the pool is released and all workers have exited
+	done  chan struct{}
+	opts  options
+	stats counters
 }
 
 // NewPool returns a new thread pool
 func NewPool(size uint64) *Pool {
-	return &Pool{maxSize: size}
+	return newPool(size, options{})
+}
+
+// NewPoolWithOptions returns a new thread pool configured with the given options
+// returns ErrInvalidPoolSize if the size is zero or an error wrapping ErrInvalidOptions for an invalid configuration
+func NewPoolWithOptions(size uint64, opts ...Option) (*Pool, error) {
+	o, err := loadOptions(size, opts)
+	if err != nil {
+		return nil, err
+	} else if o.results {
+		return nil, fmt.Errorf("%w: results channel is only supported by PoolWithResult", ErrInvalidOptions)
+	}
+	return newPool(size, o), nil
+}
+
+// newPool returns a new thread pool with already validated options
+func newPool(size uint64, o options) *Pool {
+	linkRuntime()
+	p := &Pool{maxSize: size, done: make(chan struct{}), opts: o}
+	for prio := range p.waiters {
+		p.waiters[prio].init()
+		if o.queueSize > 0 {
+			p.tasks[prio] = newQueue[*pendingTask](o.queueSize)
+		}
+	}
+	if o.rate > 0 {
+		p.limit = newLimiter(o.rate, o.burst)
+	}
+	if o.expiry > 0 {
+		go p.reap(o.expiry)
+	}
+	p.Warm(o.preSpawn)
+	return p
 }
 
 // Submit submits a new task to the pool
 // it first tries to use already parked goroutines from the stack if any
 // if there are no available worker goroutines, it tries to add a
 // new goroutine to the pool if the pool capacity is not exceeded
-// in case the pool capacity hit its maximum limit, this function yields the processor to other
-// goroutines and loops again for finding available workers
-func (self *Pool) Submit(task func()) {
-	var s *slot
+// in case the pool capacity hit its maximum limit, the task is held in the task queue if the pool has one
+// otherwise the caller is parked until a finishing worker takes over the task, blocked callers are served in FIFO order
+// a non-blocking pool returns ErrPoolOverload instead of waiting, as does a pool which already
+// has the maximum allowed number of submitters waiting
+// a rate limited pool makes the caller wait for its turn before all of this, a non-blocking one returns ErrRateLimited instead,
+// unless the task can be held in the task queue where it waits for its turn once a worker picks it up
+// returns ErrPoolClosed if the pool has been released
+func (self *Pool) Submit(task func()) error {
+	return self.submit(nil, task, PriorityNormal)
+}
+
+// SubmitContext submits a new task to the pool like Submit but stops waiting for an available worker
+// once the context is cancelled or its deadline passes, in which case the context error is returned
+func (self *Pool) SubmitContext(ctx context.Context, task func()) error {
+	return self.submit(ctx, task, PriorityNormal)
+}
+
+// submit submits the task with the given priority and parks the caller on the wait list for as long as the pool
+// is saturated, a nil context waits without any deadline
+func (self *Pool) submit(ctx context.Context, task func(), prio Priority) (err error) {
+	if self.limit != nil {
+		if queued, err := self.admit(ctx, task, prio, self.opts.nonblocking); queued || err != nil {
+			return err
+		}
+		// a rejected task does not count against the rate limit
+		defer func() {
+			if err != nil {
+				self.limit.refund()
+			}
+		}()
+	}
+	var start int64
+	defer func() { self.stats.waited(start) }()
 	for {
-		if s = self.pop(); s != nil {
-			s.task = task
-			safe_ready(s.threadPtr)
+		if ctx != nil {
+			if err = ctx.Err(); err != nil {
+				return
+			}
+		}
+		if err = self.trySubmit(task, prio); err != ErrPoolOverload || self.opts.nonblocking {
 			return
-		} else if atomic.AddUint64(&self.currSize, 1) <= self.maxSize {
-			s = &slot{task: task}
-			go self.loopQ(s)
+		} else if start == 0 {
+			if !self.stats.block(self.opts.maxBlocking) {
+				return ErrPoolOverload
+			}
+			start = nanotime()
+		}
+		w := newWaiter(task, ctx != nil)
+		self.waiters[prio].enqueue(w)
+		// a worker might have been pushed into the stack, the capacity raised or the pool released
+		// before the waiter was visible to them
+		if s := self.pop(); s != nil {
+			if w.cancel() {
+				self.assign(s, task)
+				return nil
+			}
+			// the waiter has already been claimed, keep the worker available for the others
+			self.restore(s)
+			self.balance()
+		} else if (atomic.LoadUint32(&self.state) != poolOpen || atomic.LoadUint64(&self.currSize) < atomic.LoadUint64(&self.maxSize)) && w.cancel() {
+			continue
+		}
+		if accepted, err := w.await(ctx); err != nil || accepted {
+			return err
+		}
+	}
+}
+
+// SubmitBatch submits all the tasks to the pool at once, the parked workers are popped off the stack together
+// with a single CAS and woken up with their tasks while the remaining tasks are submitted like Submit
+// returns the number of accepted tasks which is less than the number of tasks only if an error occurred, like
+// ErrPoolOverload for a non-blocking pool, in which case the tasks following the accepted ones were not submitted
+// a rate limited pool submits the tasks one by one
+func (self *Pool) SubmitBatch(tasks []func()) (accepted int, err error) {
+	for accepted < len(tasks) {
+		if self.limit != nil || atomic.LoadUint32(&self.state) != poolOpen {
+			if err = self.Submit(tasks[accepted]); err != nil {
+				return
+			}
+			accepted++
+			continue
+		}
+		curr, n := self.popBatch(len(tasks) - accepted)
+		if n == 0 {
+			// no parked workers left, spawn or wait for one like Submit
+			if err = self.Submit(tasks[accepted]); err != nil {
+				return
+			}
+			accepted++
+			continue
+		}
+		for ; n > 0; n-- {
+			next := curr.next.Load()
+			s := curr.value
+			s.task = tasks[accepted]
+			s.ready()
+			atomic.AddUint64(&self.stats.submitted, 1)
+			accepted, curr = accepted+1, next
+		}
+	}
+	return
+}
+
+// TrySubmit makes a single attempt at submitting the task to the pool without waiting
+// returns false if the pool is at its maximum capacity with all workers busy and no space left in the task queue,
+// if the rate limit has been exceeded or if the pool has been released
+func (self *Pool) TrySubmit(task func()) bool {
+	if self.limit != nil {
+		if queued, err := self.admit(nil, task, PriorityNormal, true); queued || err != nil {
+			return err == nil
+		}
+	}
+	if self.trySubmit(task, PriorityNormal) != nil {
+		if self.limit != nil {
+			self.limit.refund()
+		}
+		return false
+	}
+	return true
+}
+
+// trySubmit assigns the task to a parked worker or spawns a new one if the pool capacity is not exceeded
+// or else holds it in the task queue of its priority, returns ErrPoolOverload if none of these is possible
+// in a rate limited pool, the token taken by the caller is handed back for a queued task which instead
+// takes its token once a worker starts it
+func (self *Pool) trySubmit(task func(), prio Priority) error {
+	if atomic.LoadUint32(&self.state) != poolOpen {
+		return ErrPoolClosed
+	} else if s := self.pop(); s != nil {
+		self.assign(s, task)
+		return nil
+	} else if atomic.AddUint64(&self.currSize, 1) <= atomic.LoadUint64(&self.maxSize) {
+		// the pool might have been released after the state check above
+		if atomic.LoadUint32(&self.state) != poolOpen {
+			if !self.exit() {
+				go self.loopQ(new(slot))
+			}
+			return ErrPoolClosed
+		}
+		go self.loopQ(&slot{task: task})
+		atomic.AddUint64(&self.stats.submitted, 1)
+		return nil
+	}
+	self.unreserve()
+	if err := self.enqueue(task, prio); err != nil {
+		return err
+	} else if self.limit != nil {
+		// a queued task is charged once a worker starts it
+		self.limit.refund()
+	}
+	return nil
+}
+
+// a task held in the task queue, claimed either by the worker taking it or by its submitter withdrawing it
+type pendingTask struct {
+	task    func()
+	claimed uint32
+}
+
+// claim returns true if the caller is the first one to claim the task
+func (self *pendingTask) claim() bool {
+	return atomic.CompareAndSwapUint32(&self.claimed, 0, 1)
+}
+
+// enqueue holds the task in the task queue of its priority until a worker is available
+// returns ErrPoolOverload if the pool has no task queue or if it is full
+// the pool might have been released and its last worker might have exited before the task was visible to them,
+// hence the task is withdrawn and ErrPoolClosed returned if the pool is no longer open, unless a worker took it already
+func (self *Pool) enqueue(task func(), prio Priority) error {
+	q := self.tasks[prio]
+	if q == nil {
+		return ErrPoolOverload
+	}
+	t := &pendingTask{task: self.throttle(task)}
+	if !q.enqueue(t) {
+		return ErrPoolOverload
+	}
+	atomic.AddUint64(&self.stats.submitted, 1)
+	self.wakeup()
+	if atomic.LoadUint32(&self.state) != poolOpen && t.claim() {
+		atomic.AddUint64(&self.stats.submitted, uint64SubtractionConstant)
+		return ErrPoolClosed
+	}
+	return nil
+}
+
+// admit takes a rate token for the task, a task which cannot start right away is held in the task queue
+// if possible instead of waiting for a token, returns true if the task was queued
+// otherwise waits for a token like limiter.wait, the token is to be refunded if the task is rejected
+func (self *Pool) admit(ctx context.Context, task func(), prio Priority, nonblocking bool) (bool, error) {
+	if self.limit.take() == 0 {
+		return false, nil
+	} else if atomic.LoadUint32(&self.state) == poolOpen {
+		if err := self.enqueue(task, prio); err != ErrPoolOverload {
+			return err == nil, err
+		}
+	}
+	return false, self.limit.wait(ctx, nonblocking, &self.stats)
+}
+
+// throttle makes a task held in the task queue of a rate limited pool wait for its turn once a worker starts it
+func (self *Pool) throttle(task func()) func() {
+	if self.limit == nil {
+		return task
+	}
+	return func() {
+		self.limit.wait(nil, false, &self.stats)
+		task()
+	}
+}
+
+// assign hands the task to a parked worker and wakes it up
+func (self *Pool) assign(s *slot, task func()) {
+	s.task = task
+	s.ready()
+	atomic.AddUint64(&self.stats.submitted, 1)
+}
+
+// balance hands the tasks of blocked submitters to parked workers for as long as there are both
+// must be called after pushing a worker into the stack as a submitter might have missed it
+// the workers are woken up asynchronously since the caller might be a worker which is yet to park itself
+func (self *Pool) balance() {
+	for self.blocked() {
+		s := self.pop()
+		if s == nil {
 			return
+		} else if task, ok := self.next(true); ok {
+			s.task = task
+			go s.ready()
 		} else {
-			atomic.AddUint64(&self.currSize, uint64SubtractionConstant)
-			mcall(gosched_m)
+			// all remaining waiters were cancelled in the meantime
+			self.restore(s)
 		}
 	}
 }
 
+// restore pushes back a worker popped without being handed a task
+// the pool might have been released in the meantime, in which case the worker was missed by the drain
+func (self *Pool) restore(s *slot) {
+	self.push(s)
+	if atomic.LoadUint32(&self.state) != poolOpen {
+		self.drain(nil)
+	}
+}
+
+// Warm spawns up to n idle workers within the pool capacity and returns once all of them are parked
+// on the stack so that the following submissions are handed to them directly instead of spawning goroutines
+// returns the number of workers spawned
+func (self *Pool) Warm(n uint64) (spawned uint64) {
+	var warming []*slot
+	for ; spawned < n && atomic.LoadUint32(&self.state) == poolOpen; spawned++ {
+		if atomic.AddUint64(&self.currSize, 1) > atomic.LoadUint64(&self.maxSize) {
+			self.unreserve()
+			break
+		}
+		s := &slot{warming: 1}
+		warming = append(warming, s)
+		go self.loopQ(s)
+	}
+	// a worker which has been handed a task or released before it was seen parked is done warming as well
+	for _, s := range warming {
+		for !s.parked() && atomic.LoadUint32(&s.warming) != 0 {
+			runtime.Gosched()
+		}
+	}
+	return
+}
+
+// Stats returns a snapshot of the current state and the cumulative counters of the pool
+func (self *Pool) Stats() Stats {
+	running := atomic.LoadUint64(&self.currSize)
+	if running >= terminatedSize {
+		running = 0
+	}
+	return self.stats.snapshot(running, atomic.LoadUint64(&self.maxSize))
+}
+
+// Tune changes the capacity of the pool, a size of zero is ignored
+// raising the capacity takes effect immediately whereas on shrinking, surplus parked workers are retired
+// right away and busy workers exit after finishing their current task until the pool fits the new capacity
+func (self *Pool) Tune(size uint64) {
+	if size == 0 {
+		return
+	}
+	prev := atomic.SwapUint64(&self.maxSize, size)
+	if size >= prev {
+		// blocked submitters can now spawn new workers
+		for n := prev; n < size && self.retry(); n++ {
+		}
+		return
+	}
+	for n := atomic.LoadUint64(&self.currSize); n > size; n-- {
+		s := self.pop()
+		if s == nil {
+			return
+		}
+		s.quit = true
+		s.ready()
+	}
+}
+
+// Release closes the pool and wakes up all parked workers so that they can exit
+// busy workers exit after finishing their current task and the tasks remaining in the task queue
+// blocked submitters and further calls to Submit return ErrPoolClosed
+func (self *Pool) Release() {
+	if atomic.CompareAndSwapUint32(&self.state, poolOpen, poolClosed) && atomic.LoadUint64(&self.currSize) == 0 {
+		self.terminate()
+	}
+	self.drain(nil)
+}
+
+// Shutdown releases the pool and waits for all in-flight tasks to finish and their workers to exit
+// returns the context error if the context is done before that
+func (self *Pool) Shutdown(ctx context.Context) error {
+	self.Release()
+	select {
+	case <-self.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // loopQ is the looping function for every worker goroutine
 func (self *Pool) loopQ(s *slot) {
-	// store self goroutine pointer
-	s.threadPtr = GetG()
+	// bind the slot to self goroutine
+	s.bind()
 	for {
 		// exec task
-		s.task()
-		// notify availability by pushing self reference into stack
-		self.push(s)
-		// park and wait for call
-		mcall(fast_park)
+		if s.task != nil {
+			self.exec(s)
+		}
+		// pick up pending tasks from the queue and blocked submitters before parking
+		for self.dequeue(s) {
+			self.exec(s)
+		}
+		if self.wait(s) && self.exit() {
+			return
+		}
 	}
 }
 
-// global memory pool for all items used in Pool
-var (
-	itemPool  = sync.Pool{New: func() any { return new(node) }}
-	itemAlloc = itemPool.Get
-	itemFree  = itemPool.Put
-)
+// exec runs the task assigned to the slot, a panicking task is recovered and reported
+// so that the worker can be returned to the stack and the pool capacity is preserved
+func (self *Pool) exec(s *slot) {
+	defer func() {
+		s.task = nil
+		if r := recover(); r != nil {
+			atomic.AddUint64(&self.stats.panics, 1)
+			self.opts.handlePanic(r)
+		}
+		atomic.AddUint64(&self.stats.completed, 1)
+	}()
+	s.task()
+}
+
+// dequeue assigns the next pending task from the task queue or from a blocked submitter to the slot
+// so that a saturated pool runs it without a park and wake up round trip, returns false if there is none
+func (self *Pool) dequeue(s *slot) (ok bool) {
+	// surplus workers only finish the queued tasks and are left to exit
+	blocked := atomic.LoadUint32(&self.state) == poolOpen && atomic.LoadUint64(&self.currSize) <= atomic.LoadUint64(&self.maxSize)
+	s.task, ok = self.next(blocked)
+	return
+}
+
+// wait pushes the worker into the stack and parks it until it is called again
+// returns true if the worker should exit instead
+func (self *Pool) wait(s *slot) bool {
+	// surplus workers exit after the pool has been shrunk
+	if atomic.LoadUint32(&self.state) != poolOpen || atomic.LoadUint64(&self.currSize) > atomic.LoadUint64(&self.maxSize) {
+		s.warmed()
+		return true
+	}
+	// notify availability by pushing self reference into stack
+	s.lastUsed = nanotime()
+	self.push(s)
+	if atomic.LoadUint32(&self.state) != poolOpen {
+		// the pool might have been released after the state check above in which case
+		// there might be no one left to wake up this worker
+		if self.drain(s) {
+			s.warmed()
+			return true
+		}
+	} else if self.queued() {
+		// a task might have been queued after the last dequeue with no parked worker around to pick it up
+		if o := self.pop(); o == s {
+			s.warmed()
+			return false
+		} else if o != nil {
+			go o.ready()
+		}
+	} else {
+		// a submitter might have started waiting after the last check, this worker might be handed to it
+		self.balance()
+	}
+	// park and wait for call
+	s.park()
+	s.warmed()
+	if s.quit {
+		s.quit = false
+		return true
+	}
+	return false
+}
+
+// wakeup makes sure that a freshly queued task gets picked up by waking up a parked worker
+// or by spawning a new one in case all workers have exited, no worker is spawned for a released pool
+// as the task is withdrawn again by its submitter unless a remaining worker took it
+func (self *Pool) wakeup() {
+	if s := self.pop(); s != nil {
+		s.ready()
+	} else if atomic.LoadUint32(&self.state) == poolOpen && atomic.LoadUint64(&self.currSize) == 0 {
+		if atomic.AddUint64(&self.currSize, 1) <= atomic.LoadUint64(&self.maxSize) {
+			go self.loopQ(new(slot))
+		} else {
+			self.unreserve()
+		}
+	}
+}
+
+// drain pops all parked workers from the stack and wakes them up for exiting along with all blocked submitters
+// if called from a worker, its own slot is skipped and the other workers are woken up asynchronously
+// to avoid workers waiting on each other, returns true if the worker's own slot was popped
+func (self *Pool) drain(own *slot) (found bool) {
+	for s := self.pop(); s != nil; s = self.pop() {
+		if s == own {
+			found = true
+			continue
+		}
+		s.quit = true
+		if own == nil {
+			s.ready()
+		} else {
+			go s.ready()
+		}
+	}
+	for self.retry() {
+	}
+	return
+}
+
+// unreserve gives back the worker count taken for a worker which is not spawned after all
+// the pool might have been released meanwhile with the count keeping its last worker from terminating it
+func (self *Pool) unreserve() {
+	if atomic.AddUint64(&self.currSize, uint64SubtractionConstant) == 0 && atomic.LoadUint32(&self.state) != poolOpen {
+		self.terminate()
+	}
+}
+
+// exit decrements the pool size when a worker exits and signals termination if it was the last one
+// a task might have been queued while the worker was leaving, in which case the worker is kept alive
+// unless there are other workers around to pick it up, returns false if the worker should keep running
+func (self *Pool) exit() bool {
+	n := atomic.AddUint64(&self.currSize, uint64SubtractionConstant)
+	for self.queued() {
+		if atomic.AddUint64(&self.currSize, 1) <= atomic.LoadUint64(&self.maxSize) {
+			return false
+		} else if n = atomic.AddUint64(&self.currSize, uint64SubtractionConstant); n > 0 {
+			break
+		}
+	}
+	if n == 0 && atomic.LoadUint32(&self.state) != poolOpen {
+		self.terminate()
+	} else if n < atomic.LoadUint64(&self.maxSize) {
+		// a blocked submitter can take over the capacity freed by this worker
+		self.retry()
+	}
+	return true
+}
+
+// reap periodically retires workers which have been parked for longer than the expiry duration
+// runs until the pool is terminated
+func (self *Pool) reap(expiry time.Duration) {
+	ticker := time.NewTicker(expiry)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-self.done:
+			return
+		case <-ticker.C:
+			self.purge(nanotime() - int64(expiry))
+		}
+	}
+}
+
+// terminate marks the released pool as terminated once it has no workers left, only the first caller closes the done channel
+// the worker count is swapped for terminatedSize in the same step so that no worker can be spawned afterwards
+// tasks queued before the pool was released are still to be run, in which case a worker is revived for them instead
+func (self *Pool) terminate() {
+	if !atomic.CompareAndSwapUint64(&self.currSize, 0, terminatedSize) {
+		// a worker has been spawned in the meantime, the pool is terminated once it exits
+		return
+	} else if self.queued() {
+		// subtracts terminatedSize-1 leaving a single worker
+		atomic.AddUint64(&self.currSize, ^(terminatedSize - 2))
+		go self.loopQ(new(slot))
+		return
+	}
+	if atomic.CompareAndSwapUint32(&self.state, poolClosed, poolTerminated) {
+		close(self.done)
+	}
+}
 
 // internal lock-free stack implementation for parking and waking up goroutines
 // Credits -> https://github.com/golang-design/lockfree
+// every push allocates a fresh node and popped nodes are left to the garbage collector, recycling them would let
+// a node return to the top while a concurrent pop still holds its stale next pointer ( ABA ) and unlink parked workers
 
 // a single node in this stack
 type node struct {
@@ -92,22 +629,75 @@ func (self *Pool) pop() (value *slot) {
 		}
 		next = top.next.Load()
 		if self.top.CompareAndSwap(top, next) {
+			atomic.AddUint64(&self.stats.idle, uint64SubtractionConstant)
 			value = top.value
-			top.value = nil
-			top.next.Store(nil)
-			itemFree(top)
 			return
 		}
 	}
 }
 
+// popBatch pops up to n values from the top of the stack by detaching the chain of their nodes with a single CAS
+// returns the first node of the chain along with the number of values in it
+func (self *Pool) popBatch(n int) (top *node, count int) {
+	var last *node
+	for {
+		top = self.top.Load()
+		if top == nil {
+			return nil, 0
+		}
+		for last, count = top, 1; count < n; count++ {
+			next := last.next.Load()
+			if next == nil {
+				break
+			}
+			last = next
+		}
+		if self.top.CompareAndSwap(top, last.next.Load()) {
+			atomic.AddUint64(&self.stats.idle, ^uint64(count-1))
+			return
+		}
+	}
+}
+
+// purge detaches the whole stack and wakes up the workers parked before the deadline for exiting
+// workers popped and pushed back by submitters can lie above fresher ones, hence the whole chain is walked
+// the fresh workers are pushed back in their order with new nodes, the detached nodes are never linked again
+// so that a concurrent pop still holding one of them cannot succeed
+func (self *Pool) purge(deadline int64) {
+	var (
+		curr  = self.top.Swap(nil)
+		fresh []*slot
+	)
+	for ; curr != nil; curr = curr.next.Load() {
+		// counted again once pushed back
+		atomic.AddUint64(&self.stats.idle, uint64SubtractionConstant)
+		if s := curr.value; s.lastUsed > deadline {
+			fresh = append(fresh, s)
+		} else {
+			s.quit = true
+			s.ready()
+		}
+	}
+	for i := len(fresh) - 1; i >= 0; i-- {
+		self.push(fresh[i])
+	}
+	// the pool might have been released while the stack was detached, in which case
+	// the fresh workers were missed by the drain and have to be woken up for exiting
+	if len(fresh) > 0 && atomic.LoadUint32(&self.state) != poolOpen {
+		self.drain(nil)
+		return
+	}
+	self.balance()
+}
+
 // push pushes a value on top of the stack
 func (self *Pool) push(v *slot) {
 	var (
 		top  *node
-		item = itemAlloc().(*node)
+		item = &node{value: v}
 	)
-	item.value = v
+	// counted before being visible on the stack so that a concurrent pop never underflows the counter
+	atomic.AddUint64(&self.stats.idle, 1)
 	for {
 		top = self.top.Load()
 		item.next.Store(top)
@@ -1,16 +1,26 @@
 package itogami
 
 import (
-	"sync"
+	"context"
+	"fmt"
+	"runtime"
 	"sync/atomic"
+	"time"
 	"unsafe"
 )
 
 type (
 	// a single slot for a worker in PoolWithFunc
 	slotFunc[T any] struct {
-		threadPtr unsafe.Pointer
-		data      T
+		parker
+		data T
+		// time at which the worker was last parked
+		lastUsed int64
+		// set when the worker is woken up only to exit
+		quit bool
+		// set until a pre-spawned worker has been parked for the first time, Warm waits for it meanwhile
+		// cleared by the worker once it is woken up or exits without parking in case Warm missed it parked
+		warming uint32
 	}
 
 	// PoolWithFunc is used for spawning workers for a single pre-defined function with myriad inputs
@@ -22,52 +32,438 @@ type (
 		currSize uint64
 		_p1      [cacheLinePadSize - unsafe.Sizeof(uint64(0))]byte
 		maxSize  uint64
-		alloc    func() any
-		free     func(any)
 		task     func(T)
-		_p2      [cacheLinePadSize - unsafe.Sizeof(uint64(0)) - 3*unsafe.Sizeof(func() {})]byte
+		_p2      [cacheLinePadSize - unsafe.Sizeof(uint64(0)) - unsafe.Sizeof(func() {})]byte
 		top      atomic.Pointer[dataItem[T]]
 		_p3      [cacheLinePadSize - unsafe.Sizeof(atomic.Pointer[dataItem[T]]{})]byte
+		state    uint32
+		// rate limit of task starts, nil if the pool is not rate limited
+		limit *limiter
+		// submitters parked until a worker is available
+		waiters waitList[T]
+		// closed once the pool is released and all workers have exited
+		done  chan struct{}
+		opts  options
+		stats counters
 	}
 )
 
+// warmed notifies Warm that a pre-spawned worker is done warming as it has been woken up or is exiting
+func (self *slotFunc[T]) warmed() {
+	if atomic.LoadUint32(&self.warming) != 0 {
+		atomic.StoreUint32(&self.warming, 0)
+	}
+}
+
 // NewPoolWithFunc returns a new PoolWithFunc
 func NewPoolWithFunc[T any](size uint64, task func(T)) *PoolWithFunc[T] {
-	dataPool := sync.Pool{New: func() any { return new(dataItem[T]) }}
-	return &PoolWithFunc[T]{maxSize: size, task: task, alloc: dataPool.Get, free: dataPool.Put}
+	return newPoolWithFunc(size, task, options{})
+}
+
+// NewPoolWithFuncOptions returns a new PoolWithFunc configured with the given options
+// returns ErrInvalidPoolSize if the size is zero or an error wrapping ErrInvalidOptions for an invalid configuration
+func NewPoolWithFuncOptions[T any](size uint64, task func(T), opts ...Option) (*PoolWithFunc[T], error) {
+	o, err := loadOptions(size, opts)
+	if err != nil {
+		return nil, err
+	} else if task == nil {
+		return nil, fmt.Errorf("%w: nil task", ErrInvalidOptions)
+	} else if o.queueSize > 0 {
+		return nil, fmt.Errorf("%w: task queue is not supported by PoolWithFunc", ErrInvalidOptions)
+	} else if o.results {
+		return nil, fmt.Errorf("%w: results channel is only supported by PoolWithResult", ErrInvalidOptions)
+	}
+	return newPoolWithFunc(size, task, o), nil
+}
+
+// newPoolWithFunc returns a new PoolWithFunc with already validated options
+func newPoolWithFunc[T any](size uint64, task func(T), o options) *PoolWithFunc[T] {
+	linkRuntime()
+	p := &PoolWithFunc[T]{maxSize: size, task: task, done: make(chan struct{}), opts: o}
+	p.waiters.init()
+	if o.rate > 0 {
+		p.limit = newLimiter(o.rate, o.burst)
+	}
+	if o.expiry > 0 {
+		go p.reap(o.expiry)
+	}
+	p.Warm(o.preSpawn)
+	return p
 }
 
 // Invoke invokes the pre-defined method in PoolWithFunc by assigning the data to an already existing worker
 // or spawning a new worker given queue size is in limits
-func (self *PoolWithFunc[T]) Invoke(value T) {
-	var s *slotFunc[T]
+// otherwise the caller is parked until a finishing worker takes over the task, blocked callers are served in FIFO order
+// a non-blocking pool returns ErrPoolOverload instead of waiting for an available worker, as does a pool
+// which already has the maximum allowed number of submitters waiting
+// a rate limited pool makes the caller wait for its turn before all of this, a non-blocking one returns ErrRateLimited instead
+// returns ErrPoolClosed if the pool has been released
+func (self *PoolWithFunc[T]) Invoke(value T) error {
+	return self.invoke(nil, value)
+}
+
+// InvokeContext invokes the pre-defined method with the value like Invoke but stops waiting for an available worker
+// once the context is cancelled or its deadline passes, in which case the context error is returned
+func (self *PoolWithFunc[T]) InvokeContext(ctx context.Context, value T) error {
+	return self.invoke(ctx, value)
+}
+
+// invoke invokes the pre-defined method with the value and parks the caller on the wait list for as long as the pool is saturated
+// a nil context waits without any deadline
+func (self *PoolWithFunc[T]) invoke(ctx context.Context, value T) (err error) {
+	if self.limit != nil {
+		if err = self.limit.wait(ctx, self.opts.nonblocking, &self.stats); err != nil {
+			return
+		}
+		// a rejected value does not count against the rate limit
+		defer func() {
+			if err != nil {
+				self.limit.refund()
+			}
+		}()
+	}
+	var start int64
+	defer func() { self.stats.waited(start) }()
 	for {
-		if s = self.pop(); s != nil {
-			s.data = value
-			safe_ready(s.threadPtr)
+		if ctx != nil {
+			if err = ctx.Err(); err != nil {
+				return
+			}
+		}
+		if err = self.tryInvoke(value); err != ErrPoolOverload || self.opts.nonblocking {
 			return
-		} else if atomic.AddUint64(&self.currSize, 1) <= self.maxSize {
-			s = &slotFunc[T]{data: value}
-			go self.loopQ(s)
+		} else if start == 0 {
+			if !self.stats.block(self.opts.maxBlocking) {
+				return ErrPoolOverload
+			}
+			start = nanotime()
+		}
+		w := newWaiter(value, ctx != nil)
+		self.waiters.enqueue(w)
+		// a worker might have been pushed into the stack, the capacity raised or the pool released
+		// before the waiter was visible to them
+		if s := self.pop(); s != nil {
+			if w.cancel() {
+				self.assign(s, value)
+				return nil
+			}
+			// the waiter has already been claimed, keep the worker available for the others
+			self.restore(s)
+			self.balance()
+		} else if (atomic.LoadUint32(&self.state) != poolOpen || atomic.LoadUint64(&self.currSize) < atomic.LoadUint64(&self.maxSize)) && w.cancel() {
+			continue
+		}
+		if accepted, err := w.await(ctx); err != nil || accepted {
+			return err
+		}
+	}
+}
+
+// InvokeBatch invokes the pre-defined method with all the values at once, the parked workers are popped off the stack
+// together with a single CAS and woken up with their values while the remaining values are invoked like Invoke
+// returns the number of accepted values which is less than the number of values only if an error occurred, like
+// ErrPoolOverload for a non-blocking pool, in which case the values following the accepted ones were not invoked
+// a rate limited pool invokes the values one by one
+func (self *PoolWithFunc[T]) InvokeBatch(values []T) (accepted int, err error) {
+	for accepted < len(values) {
+		if self.limit != nil || atomic.LoadUint32(&self.state) != poolOpen {
+			if err = self.Invoke(values[accepted]); err != nil {
+				return
+			}
+			accepted++
+			continue
+		}
+		curr, n := self.popBatch(len(values) - accepted)
+		if n == 0 {
+			// no parked workers left, spawn or wait for one like Invoke
+			if err = self.Invoke(values[accepted]); err != nil {
+				return
+			}
+			accepted++
+			continue
+		}
+		for ; n > 0; n-- {
+			next := curr.next.Load()
+			s := curr.value
+			s.data = values[accepted]
+			s.ready()
+			atomic.AddUint64(&self.stats.submitted, 1)
+			accepted, curr = accepted+1, next
+		}
+	}
+	return
+}
+
+// TryInvoke makes a single attempt at invoking the pre-defined method with the value without waiting
+// returns false if the pool is at its maximum capacity with all workers busy, if the rate limit has been exceeded
+// or if the pool has been released
+func (self *PoolWithFunc[T]) TryInvoke(value T) bool {
+	if self.limit != nil && self.limit.wait(nil, true, &self.stats) != nil {
+		return false
+	} else if self.tryInvoke(value) != nil {
+		if self.limit != nil {
+			self.limit.refund()
+		}
+		return false
+	}
+	return true
+}
+
+// tryInvoke assigns the value to a parked worker or spawns a new one if the pool capacity is not exceeded
+// returns ErrPoolOverload if neither is possible
+func (self *PoolWithFunc[T]) tryInvoke(value T) error {
+	if atomic.LoadUint32(&self.state) != poolOpen {
+		return ErrPoolClosed
+	} else if s := self.pop(); s != nil {
+		self.assign(s, value)
+		return nil
+	} else if atomic.AddUint64(&self.currSize, 1) <= atomic.LoadUint64(&self.maxSize) {
+		// the pool might have been released after the state check above
+		if atomic.LoadUint32(&self.state) != poolOpen {
+			self.exit()
+			return ErrPoolClosed
+		}
+		go self.loopQ(&slotFunc[T]{data: value}, false)
+		atomic.AddUint64(&self.stats.submitted, 1)
+		return nil
+	}
+	self.unreserve()
+	return ErrPoolOverload
+}
+
+// assign hands the value to a parked worker and wakes it up
+func (self *PoolWithFunc[T]) assign(s *slotFunc[T], value T) {
+	s.data = value
+	s.ready()
+	atomic.AddUint64(&self.stats.submitted, 1)
+}
+
+// balance hands the tasks of blocked submitters to parked workers for as long as there are both
+// must be called after pushing a worker into the stack as a submitter might have missed it
+// the workers are woken up asynchronously since the caller might be a worker which is yet to park itself
+func (self *PoolWithFunc[T]) balance() {
+	for !self.waiters.empty() {
+		s := self.pop()
+		if s == nil {
 			return
+		} else if value, ok := self.waiters.take(); ok {
+			s.data = value
+			go s.ready()
+			atomic.AddUint64(&self.stats.submitted, 1)
 		} else {
-			atomic.AddUint64(&self.currSize, uint64SubtractionConstant)
-			mcall(gosched_m)
+			// all remaining waiters were cancelled in the meantime
+			self.restore(s)
+		}
+	}
+}
+
+// restore pushes back a worker popped without being handed a task
+// the pool might have been released in the meantime, in which case the worker was missed by the drain
+func (self *PoolWithFunc[T]) restore(s *slotFunc[T]) {
+	self.push(s)
+	if atomic.LoadUint32(&self.state) != poolOpen {
+		self.drain(nil)
+	}
+}
+
+// Warm spawns up to n idle workers within the pool capacity and returns once all of them are parked
+// on the stack so that the following invocations are handed to them directly instead of spawning goroutines
+// returns the number of workers spawned
+func (self *PoolWithFunc[T]) Warm(n uint64) (spawned uint64) {
+	var warming []*slotFunc[T]
+	for ; spawned < n && atomic.LoadUint32(&self.state) == poolOpen; spawned++ {
+		if atomic.AddUint64(&self.currSize, 1) > atomic.LoadUint64(&self.maxSize) {
+			self.unreserve()
+			break
 		}
+		d := &slotFunc[T]{warming: 1}
+		warming = append(warming, d)
+		go self.loopQ(d, true)
 	}
+	// a worker which has been handed a task or released before it was seen parked is done warming as well
+	for _, d := range warming {
+		for !d.parked() && atomic.LoadUint32(&d.warming) != 0 {
+			runtime.Gosched()
+		}
+	}
+	return
+}
+
+// Stats returns a snapshot of the current state and the cumulative counters of the pool
+func (self *PoolWithFunc[T]) Stats() Stats {
+	return self.stats.snapshot(atomic.LoadUint64(&self.currSize), atomic.LoadUint64(&self.maxSize))
 }
 
-// represents the infinite loop for a worker goroutine
-func (self *PoolWithFunc[T]) loopQ(d *slotFunc[T]) {
-	d.threadPtr = GetG()
+// Tune changes the capacity of the pool, a size of zero is ignored
+// raising the capacity takes effect immediately whereas on shrinking, surplus parked workers are retired
+// right away and busy workers exit after finishing their current task until the pool fits the new capacity
+func (self *PoolWithFunc[T]) Tune(size uint64) {
+	if size == 0 {
+		return
+	}
+	prev := atomic.SwapUint64(&self.maxSize, size)
+	if size >= prev {
+		// blocked submitters can now spawn new workers
+		for n := prev; n < size && self.waiters.retry(); n++ {
+		}
+		return
+	}
+	for n := atomic.LoadUint64(&self.currSize); n > size; n-- {
+		s := self.pop()
+		if s == nil {
+			return
+		}
+		s.quit = true
+		s.ready()
+	}
+}
+
+// Release closes the pool and wakes up all parked workers so that they can exit
+// busy workers exit after finishing their current task
+// blocked submitters and further calls to Invoke return ErrPoolClosed
+func (self *PoolWithFunc[T]) Release() {
+	if atomic.CompareAndSwapUint32(&self.state, poolOpen, poolClosed) && atomic.LoadUint64(&self.currSize) == 0 {
+		self.terminate()
+	}
+	self.drain(nil)
+}
+
+// Shutdown releases the pool and waits for all in-flight tasks to finish and their workers to exit
+// returns the context error if the context is done before that
+func (self *PoolWithFunc[T]) Shutdown(ctx context.Context) error {
+	self.Release()
+	select {
+	case <-self.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// represents the infinite loop for a worker goroutine, an idle worker parks before executing the task
+// a worker only parks once there are no blocked submitters left to take over
+func (self *PoolWithFunc[T]) loopQ(d *slotFunc[T], idle bool) {
+	var zero T
+	d.bind()
+	for quit := idle && self.wait(d); !quit; quit = !self.dequeue(d) && self.wait(d) {
+		self.exec(d)
+		d.data = zero
+	}
+	self.exit()
+}
+
+// dequeue takes over the value of a blocked submitter so that a saturated pool runs it without
+// a park and wake up round trip, returns false if there is none
+func (self *PoolWithFunc[T]) dequeue(d *slotFunc[T]) (ok bool) {
+	// surplus workers are left to exit
+	if atomic.LoadUint32(&self.state) == poolOpen && atomic.LoadUint64(&self.currSize) <= atomic.LoadUint64(&self.maxSize) {
+		if d.data, ok = self.waiters.take(); ok {
+			atomic.AddUint64(&self.stats.submitted, 1)
+		}
+	}
+	return
+}
+
+// wait pushes the worker into the stack and parks it until it is called again
+// returns true if the worker should exit instead
+func (self *PoolWithFunc[T]) wait(d *slotFunc[T]) bool {
+	// surplus workers exit after the pool has been shrunk
+	if atomic.LoadUint32(&self.state) != poolOpen || atomic.LoadUint64(&self.currSize) > atomic.LoadUint64(&self.maxSize) {
+		d.warmed()
+		return true
+	}
+	d.lastUsed = nanotime()
+	self.push(d)
+	// the pool might have been released after the state check above
+	if atomic.LoadUint32(&self.state) != poolOpen {
+		if self.drain(d) {
+			d.warmed()
+			return true
+		}
+	} else {
+		// a submitter might have started waiting after the last check, this worker might be handed to it
+		self.balance()
+	}
+	d.park()
+	d.warmed()
+	return d.quit
+}
+
+// exec runs the pre-defined task with the slot data, recovering and reporting any panic
+// so that the worker can be returned to the stack and the pool capacity is preserved
+func (self *PoolWithFunc[T]) exec(d *slotFunc[T]) {
+	defer func() {
+		if r := recover(); r != nil {
+			atomic.AddUint64(&self.stats.panics, 1)
+			self.opts.handlePanic(r)
+		}
+		atomic.AddUint64(&self.stats.completed, 1)
+	}()
+	self.task(d.data)
+}
+
+// drain pops all parked workers from the stack and wakes them up for exiting along with all blocked submitters
+// returns true if the worker's own slot was popped
+func (self *PoolWithFunc[T]) drain(own *slotFunc[T]) (found bool) {
+	for s := self.pop(); s != nil; s = self.pop() {
+		if s == own {
+			found = true
+			continue
+		}
+		s.quit = true
+		if own == nil {
+			s.ready()
+		} else {
+			go s.ready()
+		}
+	}
+	for self.waiters.retry() {
+	}
+	return
+}
+
+// unreserve gives back the worker count taken for a worker which is not spawned after all
+// the pool might have been released meanwhile with the count keeping its last worker from terminating it
+func (self *PoolWithFunc[T]) unreserve() {
+	if atomic.AddUint64(&self.currSize, uint64SubtractionConstant) == 0 && atomic.LoadUint32(&self.state) != poolOpen {
+		self.terminate()
+	}
+}
+
+// exit decrements the pool size when a worker exits and signals termination if it was the last one
+func (self *PoolWithFunc[T]) exit() {
+	if n := atomic.AddUint64(&self.currSize, uint64SubtractionConstant); n == 0 && atomic.LoadUint32(&self.state) != poolOpen {
+		self.terminate()
+	} else if n < atomic.LoadUint64(&self.maxSize) {
+		// a blocked submitter can take over the capacity freed by this worker
+		self.waiters.retry()
+	}
+}
+
+// reap periodically retires workers which have been parked for longer than the expiry duration
+// runs until the pool is terminated
+func (self *PoolWithFunc[T]) reap(expiry time.Duration) {
+	ticker := time.NewTicker(expiry)
+	defer ticker.Stop()
 	for {
-		self.task(d.data)
-		self.push(d)
-		mcall(fast_park)
+		select {
+		case <-self.done:
+			return
+		case <-ticker.C:
+			self.purge(nanotime() - int64(expiry))
+		}
+	}
+}
+
+// terminate marks the pool as terminated, only the first caller closes the done channel
+func (self *PoolWithFunc[T]) terminate() {
+	if atomic.CompareAndSwapUint32(&self.state, poolClosed, poolTerminated) {
+		close(self.done)
 	}
 }
 
 // Stack implementation below for storing goroutine references
+// nodes are allocated on every push and never recycled so that a pop holding a stale top cannot succeed ( ABA )
 
 // a single node in the stack
 type dataItem[T any] struct {
@@ -85,22 +481,75 @@ func (self *PoolWithFunc[T]) pop() (value *slotFunc[T]) {
 		}
 		next = top.next.Load()
 		if self.top.CompareAndSwap(top, next) {
+			atomic.AddUint64(&self.stats.idle, uint64SubtractionConstant)
 			value = top.value
-			top.value = nil
-			top.next.Store(nil)
-			self.free(top)
 			return
 		}
 	}
 }
 
+// popBatch pops up to n values from the top of the stack by detaching the chain of their nodes with a single CAS
+// returns the first node of the chain along with the number of values in it
+func (self *PoolWithFunc[T]) popBatch(n int) (top *dataItem[T], count int) {
+	var last *dataItem[T]
+	for {
+		top = self.top.Load()
+		if top == nil {
+			return nil, 0
+		}
+		for last, count = top, 1; count < n; count++ {
+			next := last.next.Load()
+			if next == nil {
+				break
+			}
+			last = next
+		}
+		if self.top.CompareAndSwap(top, last.next.Load()) {
+			atomic.AddUint64(&self.stats.idle, ^uint64(count-1))
+			return
+		}
+	}
+}
+
+// purge detaches the whole stack and wakes up the workers parked before the deadline for exiting
+// workers popped and pushed back by submitters can lie above fresher ones, hence the whole chain is walked
+// the fresh workers are pushed back in their order with new nodes, the detached nodes are never linked again
+// so that a concurrent pop still holding one of them cannot succeed
+func (self *PoolWithFunc[T]) purge(deadline int64) {
+	var (
+		curr  = self.top.Swap(nil)
+		fresh []*slotFunc[T]
+	)
+	for ; curr != nil; curr = curr.next.Load() {
+		// counted again once pushed back
+		atomic.AddUint64(&self.stats.idle, uint64SubtractionConstant)
+		if s := curr.value; s.lastUsed > deadline {
+			fresh = append(fresh, s)
+		} else {
+			s.quit = true
+			s.ready()
+		}
+	}
+	for i := len(fresh) - 1; i >= 0; i-- {
+		self.push(fresh[i])
+	}
+	// the pool might have been released while the stack was detached, in which case
+	// the fresh workers were missed by the drain and have to be woken up for exiting
+	if len(fresh) > 0 && atomic.LoadUint32(&self.state) != poolOpen {
+		self.drain(nil)
+		return
+	}
+	self.balance()
+}
+
 // push pushes a value on top of the stack
 func (self *PoolWithFunc[T]) push(v *slotFunc[T]) {
 	var (
 		top  *dataItem[T]
-		item = self.alloc().(*dataItem[T])
+		item = &dataItem[T]{value: v}
 	)
-	item.value = v
+	// counted before being visible on the stack so that a concurrent pop never underflows the counter
+	atomic.AddUint64(&self.stats.idle, 1)
 	for {
 		top = self.top.Load()
 		item.next.Store(top)
@@ -0,0 +1,205 @@
+package itogami
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPoolWithFuncInvokesAllValues(t *testing.T) {
+	const invokers, values = 32, 1000
+	for _, size := range []uint64{1, 2, 8} {
+		var sum, rejected int64
+		p := NewPoolWithFunc(size, func(v int) { atomic.AddInt64(&sum, int64(v)) })
+		var wg sync.WaitGroup
+		for g := 0; g < invokers; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 1; i <= values; i++ {
+					if g%4 != 0 {
+						if err := p.Invoke(i); err != nil {
+							t.Error(err)
+						}
+						continue
+					}
+					ctx, cancel := context.WithTimeout(context.Background(), time.Duration(i%50)*time.Microsecond)
+					if err := p.InvokeContext(ctx, i); err != nil {
+						atomic.AddInt64(&rejected, int64(i))
+					}
+					cancel()
+				}
+			}(g)
+		}
+		wg.Wait()
+		if err := p.Shutdown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if want := int64(invokers * values * (values + 1) / 2); sum+rejected != want {
+			t.Fatalf("size %d: invoked values sum up to %d, want %d", size, sum+rejected, want)
+		}
+		if s := p.Stats(); s.Running != 0 || s.Idle != 0 || s.Blocking != 0 {
+			t.Fatalf("size %d: unexpected stats after shutdown %+v", size, s)
+		}
+	}
+}
+
+func TestPoolWithFuncShutdownWhileInvoking(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		p := NewPoolWithFunc(4, func(int) {})
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			for v := 0; ; v++ {
+				if err := p.Invoke(v); err != nil {
+					if err != ErrPoolClosed {
+						t.Error(err)
+					}
+					return
+				}
+			}
+		}()
+		time.Sleep(100 * time.Microsecond)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := p.Shutdown(ctx); err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+		<-stopped
+	}
+}
+
+func TestPoolWithFuncTryInvoke(t *testing.T) {
+	gate := make(chan struct{})
+	var ran int64
+	p := NewPoolWithFunc(1, func(v int) {
+		atomic.AddInt64(&ran, int64(v))
+		<-gate
+	})
+	if !p.TryInvoke(1) {
+		t.Fatal("TryInvoke failed on an idle pool")
+	}
+	if p.TryInvoke(2) {
+		t.Fatal("TryInvoke succeeded on a saturated pool")
+	}
+	close(gate)
+	waitFor(t, "the worker to be available", func() bool { return p.TryInvoke(4) })
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if ran != 5 {
+		t.Fatalf("invoked values sum up to %d, want only the accepted 1 and 4", ran)
+	}
+	if p.TryInvoke(8) {
+		t.Fatal("TryInvoke succeeded on a closed pool")
+	}
+}
+
+func TestPoolWithFuncTryInvokeRateLimited(t *testing.T) {
+	p, err := NewPoolWithFuncOptions(4, func(int) {}, WithRateLimit(1, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release()
+	for i := 0; i < 2; i++ {
+		if !p.TryInvoke(i) {
+			t.Fatal("TryInvoke failed within the burst")
+		}
+	}
+	// a blocking pool does not wait for a token either
+	if p.TryInvoke(2) {
+		t.Fatal("TryInvoke succeeded beyond the burst")
+	}
+	if s := p.Stats(); s.Submitted != 2 || s.Throttled != 1 {
+		t.Fatalf("unexpected stats after the throttled TryInvoke %+v", s)
+	}
+}
+
+func TestPoolWithFuncShutdownAfterBursts(t *testing.T) {
+	for i := 0; i < 300; i++ {
+		p := NewPoolWithFunc(16, func(int) {})
+		var wg sync.WaitGroup
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for v := 0; v < 300; v++ {
+					p.Invoke(v)
+				}
+			}()
+		}
+		wg.Wait()
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		if err := p.Shutdown(ctx); err != nil {
+			t.Fatalf("iteration %d: Shutdown = %v, stats %+v", i, err, p.Stats())
+		}
+		cancel()
+	}
+}
+
+func TestPoolWithFuncTune(t *testing.T) {
+	p := NewPoolWithFunc(10, func(int) { time.Sleep(time.Millisecond) })
+	defer p.Release()
+	for i := 0; i < 100; i++ {
+		p.Invoke(i)
+	}
+	p.Tune(2)
+	waitFor(t, "the pool to shrink", func() bool { return p.Stats().Running == 2 })
+}
+
+func TestPoolWithFuncInvokeBatch(t *testing.T) {
+	var sum int64
+	p := NewPoolWithFunc(4, func(v int) { atomic.AddInt64(&sum, int64(v)) })
+	if n := p.Warm(3); n != 3 {
+		t.Fatalf("Warm(3) = %d", n)
+	}
+	// three values go to the parked workers detached at once and the others are invoked like Invoke
+	values := make([]int, 20)
+	for i := range values {
+		values[i] = i + 1
+	}
+	if n, err := p.InvokeBatch(values); n != len(values) || err != nil {
+		t.Fatalf("InvokeBatch = %d, %v", n, err)
+	}
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if s := p.Stats(); sum != 210 || s.Submitted != 20 || s.Completed != 20 {
+		t.Fatalf("batched values sum up to %d, want 210, stats %+v", sum, s)
+	}
+	if n, err := p.InvokeBatch(values); n != 0 || err != ErrPoolClosed {
+		t.Fatalf("InvokeBatch after Shutdown = %d, %v, want 0, %v", n, err, ErrPoolClosed)
+	}
+}
+
+func TestPoolWithFuncInvokeBatchNonblocking(t *testing.T) {
+	gate := make(chan struct{})
+	var ran int64
+	p, err := NewPoolWithFuncOptions(2, func(int) {
+		atomic.AddInt64(&ran, 1)
+		<-gate
+	}, WithNonblocking(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release()
+	defer close(gate)
+	if n, err := p.InvokeBatch([]int{1, 2, 3, 4}); n != 2 || err != ErrPoolOverload {
+		t.Fatalf("InvokeBatch beyond the capacity = %d, %v, want 2, %v", n, err, ErrPoolOverload)
+	}
+	waitFor(t, "the accepted values to be invoked", func() bool { return atomic.LoadInt64(&ran) == 2 })
+}
+
+func TestPoolWithFuncInvokeBatchRateLimited(t *testing.T) {
+	p, err := NewPoolWithFuncOptions(4, func(int) {}, WithNonblocking(true), WithRateLimit(1, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release()
+	p.Warm(4)
+	if n, err := p.InvokeBatch([]int{1, 2, 3}); n != 2 || err != ErrRateLimited {
+		t.Fatalf("InvokeBatch beyond the burst = %d, %v, want 2, %v", n, err, ErrRateLimited)
+	}
+}
@@ -0,0 +1,613 @@
+package itogami
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitFor polls the condition until it holds, failing the test after a generous timeout
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// occupy keeps n workers of the pool busy until the returned function is called, which can be called many times
+func occupy(t *testing.T, p *Pool, n int) func() {
+	t.Helper()
+	var once sync.Once
+	gate := make(chan struct{})
+	for i := 0; i < n; i++ {
+		if err := p.Submit(func() { <-gate }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return func() { once.Do(func() { close(gate) }) }
+}
+
+func TestPoolRunsAllTasks(t *testing.T) {
+	const submitters, tasks = 32, 1000
+	for _, size := range []uint64{1, 2, 8} {
+		p := NewPool(size)
+		var ran, rejected int64
+		var wg sync.WaitGroup
+		for g := 0; g < submitters; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < tasks; i++ {
+					task := func() { atomic.AddInt64(&ran, 1) }
+					if g%4 != 0 {
+						if err := p.Submit(task); err != nil {
+							t.Error(err)
+						}
+						continue
+					}
+					// some submitters give up waiting while the pool is saturated
+					ctx, cancel := context.WithTimeout(context.Background(), time.Duration(i%50)*time.Microsecond)
+					if err := p.SubmitContext(ctx, task); err != nil {
+						atomic.AddInt64(&rejected, 1)
+					}
+					cancel()
+				}
+			}(g)
+		}
+		wg.Wait()
+		if err := p.Shutdown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if ran+rejected != submitters*tasks {
+			t.Fatalf("size %d: %d tasks ran and %d were rejected, want %d in total", size, ran, rejected, submitters*tasks)
+		}
+		if s := p.Stats(); s.Running != 0 || s.Idle != 0 || s.Blocking != 0 || s.Completed != uint64(ran) {
+			t.Fatalf("size %d: unexpected stats after shutdown %+v", size, s)
+		}
+	}
+}
+
+func TestPoolBlockedSubmittersFIFO(t *testing.T) {
+	p := NewPool(1)
+	defer p.Release()
+	release := occupy(t, p, 1)
+
+	var mu sync.Mutex
+	var order []int
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		i := i
+		wg.Add(1)
+		go p.Submit(func() {
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+			wg.Done()
+		})
+		waitFor(t, "the submitter to block", func() bool { return p.Stats().Blocking == uint64(i+1) })
+	}
+	release()
+	wg.Wait()
+	for i, v := range order {
+		if v != i {
+			t.Fatalf("blocked submitters were served in order %v", order)
+		}
+	}
+}
+
+func TestPoolMaxBlockingTasks(t *testing.T) {
+	const max = 3
+	p, err := NewPoolWithOptions(1, WithMaxBlockingTasks(max))
+	if err != nil {
+		t.Fatal(err)
+	}
+	release := occupy(t, p, 1)
+
+	errs := make(chan error, max)
+	for i := 0; i < max; i++ {
+		go func() { errs <- p.Submit(func() {}) }()
+	}
+	waitFor(t, "the submitters to block", func() bool { return p.Stats().Blocking == max })
+	// the submitter beyond the limit is rejected right away instead of waiting
+	done := make(chan error, 1)
+	go func() { done <- p.Submit(func() {}) }()
+	select {
+	case err := <-done:
+		if err != ErrPoolOverload {
+			t.Fatalf("Submit beyond the blocking limit = %v, want %v", err, ErrPoolOverload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Submit beyond the blocking limit is waiting")
+	}
+	if s := p.Stats(); s.Blocking != max {
+		t.Fatalf("Blocking = %d after the rejected submission, want %d", s.Blocking, max)
+	}
+
+	release()
+	for i := 0; i < max; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("blocked Submit = %v", err)
+		}
+	}
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPoolSubmitContextCancelled(t *testing.T) {
+	p := NewPool(1)
+	defer p.Release()
+	release := occupy(t, p, 1)
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	ran := make(chan struct{}, 1)
+	if err := p.SubmitContext(ctx, func() { ran <- struct{}{} }); err != context.DeadlineExceeded {
+		t.Fatalf("SubmitContext = %v, want %v", err, context.DeadlineExceeded)
+	}
+	release()
+	time.Sleep(10 * time.Millisecond)
+	if len(ran) != 0 {
+		t.Fatal("task of a cancelled submission ran")
+	}
+	if s := p.Stats(); s.Blocking != 0 {
+		t.Fatalf("Blocking = %d after the submitter gave up", s.Blocking)
+	}
+}
+
+func TestPoolReleaseWakesBlockedSubmitters(t *testing.T) {
+	p := NewPool(1)
+	release := occupy(t, p, 1)
+
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() { errs <- p.Submit(func() {}) }()
+	}
+	waitFor(t, "both submitters to block", func() bool { return p.Stats().Blocking == 2 })
+	p.Release()
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != ErrPoolClosed {
+			t.Fatalf("blocked Submit = %v, want %v", err, ErrPoolClosed)
+		}
+	}
+	release()
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Submit(func() {}); err != ErrPoolClosed {
+		t.Fatalf("Submit after Shutdown = %v, want %v", err, ErrPoolClosed)
+	}
+}
+
+func TestPoolShutdownRunsQueuedTasks(t *testing.T) {
+	p, err := NewPoolWithOptions(2, WithTaskQueue(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	release := occupy(t, p, 2)
+	var ran int64
+	for i := 0; i < 100; i++ {
+		if err := p.Submit(func() { atomic.AddInt64(&ran, 1) }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s := p.Stats(); s.Blocking != 0 {
+		t.Fatalf("submitters blocked although the task queue had room: %+v", s)
+	}
+
+	done := make(chan error)
+	go func() { done <- p.Shutdown(context.Background()) }()
+	time.Sleep(10 * time.Millisecond)
+	release()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if ran != 100 {
+		t.Fatalf("%d queued tasks ran before Shutdown returned, want 100", ran)
+	}
+}
+
+func TestPoolTaskQueuedAfterTermination(t *testing.T) {
+	p, err := NewPoolWithOptions(1, WithTaskQueue(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// a submitter which found the pool open right before it was released and terminated
+	ran := make(chan struct{}, 1)
+	if err := p.enqueue(func() { ran <- struct{}{} }, PriorityNormal); err != ErrPoolClosed {
+		t.Fatalf("enqueue on a terminated pool = %v, want %v", err, ErrPoolClosed)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if len(ran) != 0 {
+		t.Fatal("task queued on a terminated pool ran")
+	}
+	if s := p.Stats(); s.Running != 0 || s.Submitted != 0 {
+		t.Fatalf("unexpected stats after the task was withdrawn %+v", s)
+	}
+}
+
+func TestPoolTerminationRunsPendingTasks(t *testing.T) {
+	p, err := NewPoolWithOptions(1, WithTaskQueue(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a task queued right after the last worker checked the task queue on exiting
+	ran := false
+	p.tasks[PriorityNormal].enqueue(&pendingTask{task: func() { ran = true }})
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !ran {
+		t.Fatal("pending task did not run before Shutdown returned")
+	}
+	if s := p.Stats(); s.Running != 0 {
+		t.Fatalf("Running = %d after Shutdown", s.Running)
+	}
+}
+
+func TestPoolNonblockingQueueOverload(t *testing.T) {
+	p, err := NewPoolWithOptions(1, WithTaskQueue(1), WithNonblocking(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release()
+	release := occupy(t, p, 1)
+	defer release()
+
+	if err := p.Submit(func() {}); err != nil {
+		t.Fatalf("Submit into the task queue = %v", err)
+	}
+	if err := p.Submit(func() {}); err != ErrPoolOverload {
+		t.Fatalf("Submit with a full task queue = %v, want %v", err, ErrPoolOverload)
+	}
+}
+
+func TestPoolTrySubmit(t *testing.T) {
+	p := NewPool(1)
+	release := occupy(t, p, 1)
+	if p.TrySubmit(func() {}) {
+		t.Fatal("TrySubmit succeeded on a saturated pool")
+	}
+	if s := p.Stats(); s.Blocking != 0 || s.Submitted != 1 {
+		t.Fatalf("unexpected stats after the rejected TrySubmit %+v", s)
+	}
+	release()
+	ran := make(chan struct{})
+	waitFor(t, "the worker to be available", func() bool { return p.TrySubmit(func() { close(ran) }) })
+	<-ran
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if p.TrySubmit(func() {}) {
+		t.Fatal("TrySubmit succeeded on a closed pool")
+	}
+}
+
+func TestPoolShutdownWaitsForRunningTasks(t *testing.T) {
+	p := NewPool(4)
+	release := occupy(t, p, 4)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := p.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Shutdown with busy workers = %v, want %v", err, context.DeadlineExceeded)
+	}
+	release()
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPoolShutdownDuringRejectedSpawn(t *testing.T) {
+	p := NewPool(1)
+	release := occupy(t, p, 1)
+	// a submitter which took a worker count on a saturated pool and is yet to give it back
+	atomic.AddUint64(&p.currSize, 1)
+	p.Release()
+	release()
+	waitFor(t, "the busy worker to exit", func() bool { return atomic.LoadUint64(&p.currSize) == 1 })
+	p.unreserve()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := p.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown after the count was given back = %v", err)
+	}
+}
+
+func TestPoolShutdownDuringWorkerRestore(t *testing.T) {
+	p := NewPool(1)
+	if n := p.Warm(1); n != 1 {
+		t.Fatalf("Warm(1) = %d", n)
+	}
+	// a submitter which popped the worker for a waiter claimed by someone else
+	s := p.pop()
+	if s == nil {
+		t.Fatal("no parked worker after Warm")
+	}
+	p.Release()
+	p.restore(s)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := p.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown after the worker was pushed back = %v", err)
+	}
+}
+
+func TestPoolShutdownAfterBursts(t *testing.T) {
+	// workers are popped and pushed back at a high rate, a parked worker lost from the stack makes Shutdown hang
+	for i := 0; i < 300; i++ {
+		p := NewPool(16)
+		var wg sync.WaitGroup
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 300; j++ {
+					p.Submit(func() {})
+				}
+			}()
+		}
+		wg.Wait()
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		if err := p.Shutdown(ctx); err != nil {
+			t.Fatalf("iteration %d: Shutdown = %v, stats %+v", i, err, p.Stats())
+		}
+		cancel()
+	}
+}
+
+func TestPoolTune(t *testing.T) {
+	p := NewPool(10)
+	defer p.Release()
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		p.Submit(func() {
+			time.Sleep(time.Millisecond)
+			wg.Done()
+		})
+	}
+	wg.Wait()
+
+	p.Tune(3)
+	waitFor(t, "the pool to shrink", func() bool { return p.Stats().Running == 3 })
+
+	p.Tune(20)
+	var curr, max int64
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		p.Submit(func() {
+			c := atomic.AddInt64(&curr, 1)
+			for m := atomic.LoadInt64(&max); c > m && !atomic.CompareAndSwapInt64(&max, m, c); m = atomic.LoadInt64(&max) {
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt64(&curr, -1)
+			wg.Done()
+		})
+	}
+	wg.Wait()
+	if max != 20 {
+		t.Fatalf("%d tasks ran at once after growing the pool to 20", max)
+	}
+}
+
+func TestPoolTuneWakesBlockedSubmitter(t *testing.T) {
+	p := NewPool(1)
+	defer p.Release()
+	release := occupy(t, p, 1)
+	defer release()
+
+	done := make(chan struct{})
+	go p.Submit(func() { close(done) })
+	waitFor(t, "the submitter to block", func() bool { return p.Stats().Blocking == 1 })
+	p.Tune(2)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("blocked submitter did not take over the raised capacity")
+	}
+}
+
+func TestPoolWarm(t *testing.T) {
+	p, err := NewPoolWithOptions(8, WithPreSpawn(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release()
+	if s := p.Stats(); s.Running != 4 || s.Idle != 4 {
+		t.Fatalf("stats after pre-spawning 4 workers %+v", s)
+	}
+	if n := p.Warm(10); n != 4 {
+		t.Fatalf("Warm spawned %d workers, want the 4 left within the capacity", n)
+	}
+	if s := p.Stats(); s.Running != 8 || s.Idle != 8 {
+		t.Fatalf("stats after warming up the whole pool %+v", s)
+	}
+	// every worker is parked by the time Warm returns
+	for n := p.top.Load(); n != nil; n = n.next.Load() {
+		if !n.value.parked() {
+			t.Fatal("Warm returned before a worker was parked")
+		}
+	}
+}
+
+func TestPoolExpiry(t *testing.T) {
+	p, err := NewPoolWithOptions(50, WithExpiryDuration(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 500; i++ {
+		wg.Add(1)
+		p.Submit(func() {
+			time.Sleep(time.Millisecond)
+			wg.Done()
+		})
+	}
+	wg.Wait()
+	waitFor(t, "idle workers to expire", func() bool { return p.Stats().Running == 0 })
+
+	// the pool keeps working after all workers expired
+	wg.Add(1)
+	if err := p.Submit(wg.Done); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPoolPanicRecovered(t *testing.T) {
+	var recovered int64
+	p, err := NewPoolWithOptions(1, WithPanicHandler(func(any) { atomic.AddInt64(&recovered, 1) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		p.Submit(func() { panic("boom") })
+	}
+	// the worker survives the panics
+	ran := make(chan struct{})
+	p.Submit(func() { close(ran) })
+	<-ran
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if s := p.Stats(); s.Panics != 3 || s.Completed != 4 || recovered != 3 {
+		t.Fatalf("%d panics handled, stats %+v", recovered, s)
+	}
+}
+
+func TestPoolInvalidOptions(t *testing.T) {
+	if _, err := NewPoolWithOptions(0); err != ErrInvalidPoolSize {
+		t.Fatalf("zero size = %v, want %v", err, ErrInvalidPoolSize)
+	}
+	for _, opt := range []Option{
+		WithExpiryDuration(-time.Second),
+		WithPreSpawn(2),
+		WithRateLimit(-1, 1),
+		WithRateLimit(1, 0),
+		WithResults(1),
+	} {
+		if _, err := NewPoolWithOptions(1, opt); !errors.Is(err, ErrInvalidOptions) {
+			t.Fatalf("invalid option accepted: %v", err)
+		}
+	}
+}
+
+func TestPoolPopBatch(t *testing.T) {
+	p := NewPool(4)
+	if n := p.Warm(4); n != 4 {
+		t.Fatalf("Warm(4) = %d", n)
+	}
+	// the top three workers are detached together, leaving the last one on the stack
+	top, n := p.popBatch(3)
+	if n != 3 || top == nil {
+		t.Fatalf("popBatch(3) detached %d workers", n)
+	}
+	last := top.next.Load().next.Load()
+	if rest := p.top.Load(); rest == nil || rest != last.next.Load() || rest.next.Load() != nil {
+		t.Fatal("popBatch(3) did not leave exactly the fourth worker on the stack")
+	}
+	if s := p.Stats(); s.Idle != 1 {
+		t.Fatalf("Idle = %d after popping 3 of 4 workers", s.Idle)
+	}
+	// a batch larger than the stack takes whatever is left
+	rest, n := p.popBatch(10)
+	if n != 1 || rest == nil {
+		t.Fatalf("popBatch(10) detached %d workers, want the 1 left", n)
+	}
+	if top, n := p.popBatch(1); n != 0 || top != nil {
+		t.Fatalf("popBatch on an empty stack detached %d workers", n)
+	}
+	// hand the detached workers back so that they exit on Shutdown
+	for curr, i := top, 0; i < 3; curr, i = curr.next.Load(), i+1 {
+		p.push(curr.value)
+	}
+	p.push(rest.value)
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPoolSubmitBatch(t *testing.T) {
+	p := NewPool(4)
+	if n := p.Warm(2); n != 2 {
+		t.Fatalf("Warm(2) = %d", n)
+	}
+	// two tasks go to the parked workers and the others spawn or wait for one like Submit
+	var ran int64
+	tasks := make([]func(), 10)
+	for i := range tasks {
+		tasks[i] = func() { atomic.AddInt64(&ran, 1) }
+	}
+	if n, err := p.SubmitBatch(tasks); n != len(tasks) || err != nil {
+		t.Fatalf("SubmitBatch = %d, %v", n, err)
+	}
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if s := p.Stats(); ran != 10 || s.Submitted != 10 || s.Completed != 10 {
+		t.Fatalf("%d of 10 batched tasks ran, stats %+v", ran, s)
+	}
+	if n, err := p.SubmitBatch(tasks); n != 0 || err != ErrPoolClosed {
+		t.Fatalf("SubmitBatch after Shutdown = %d, %v, want 0, %v", n, err, ErrPoolClosed)
+	}
+}
+
+func TestPoolSubmitBatchNonblocking(t *testing.T) {
+	p, err := NewPoolWithOptions(2, WithNonblocking(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release()
+	release := occupy(t, p, 1)
+	defer release()
+
+	// only the first task finds a free worker, the following ones are not submitted
+	var ran int64
+	gate := make(chan struct{})
+	defer close(gate)
+	task := func() {
+		atomic.AddInt64(&ran, 1)
+		<-gate
+	}
+	if n, err := p.SubmitBatch([]func(){task, task, task}); n != 1 || err != ErrPoolOverload {
+		t.Fatalf("SubmitBatch on a nearly saturated pool = %d, %v, want 1, %v", n, err, ErrPoolOverload)
+	}
+	waitFor(t, "the accepted task to run", func() bool { return atomic.LoadInt64(&ran) == 1 })
+	time.Sleep(10 * time.Millisecond)
+	if n := atomic.LoadInt64(&ran); n != 1 {
+		t.Fatalf("%d batched tasks ran, want only the accepted one", n)
+	}
+}
+
+func TestPoolSubmitBatchRateLimited(t *testing.T) {
+	p, err := NewPoolWithOptions(4, WithNonblocking(true), WithRateLimit(1, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release()
+	p.Warm(4)
+	// a rate limited pool submits the tasks one by one instead of handing them to the parked workers at once
+	if n, err := p.SubmitBatch([]func(){func() {}, func() {}, func() {}}); n != 2 || err != ErrRateLimited {
+		t.Fatalf("SubmitBatch beyond the burst = %d, %v, want 2, %v", n, err, ErrRateLimited)
+	}
+	if s := p.Stats(); s.Submitted != 2 {
+		t.Fatalf("Submitted = %d, want the 2 tasks within the burst", s.Submitted)
+	}
+}
@@ -0,0 +1,101 @@
+package itogami
+
+import "sync/atomic"
+
+// Priority of a task submitted to a Pool
+// once the pool is saturated, finishing workers take over the pending task with the highest priority first
+type Priority uint8
+
+// priority levels of a task
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+	// number of priority levels
+	priorityLevels = iota
+)
+
+// every starvationGuard-th pending task is taken from the lowest priority level instead of the highest one
+// so that a steady stream of higher priority tasks cannot starve the lower priority ones
+const starvationGuard = 16
+
+// SubmitWithPriority submits a new task to the pool like Submit with the given priority
+// priorities above PriorityHigh are treated as PriorityHigh
+func (self *Pool) SubmitWithPriority(task func(), prio Priority) error {
+	if prio >= priorityLevels {
+		prio = PriorityHigh
+	}
+	return self.submit(nil, task, prio)
+}
+
+// next takes the pending task with the highest priority from the task queues and, if blocked is set, from the blocked
+// submitters, every starvationGuard-th pending task taken is the one with the lowest priority instead
+// only the tasks actually taken count as turns so that idle workers polling empty queues do not skew the guard
+func (self *Pool) next(blocked bool) (task func(), ok bool) {
+	if (self.turns.Load()+1)%starvationGuard == 0 {
+		for prio := PriorityLow; prio < priorityLevels && !ok; prio++ {
+			task, ok = self.nextAt(prio, blocked)
+		}
+	} else {
+		for prio := PriorityHigh; ; prio-- {
+			if task, ok = self.nextAt(prio, blocked); ok || prio == PriorityLow {
+				break
+			}
+		}
+	}
+	if ok {
+		self.turns.Add(1)
+	}
+	return
+}
+
+// nextAt takes a pending task with the given priority, tasks held in the task queue go first
+// followed by the blocked submitters if blocked is set
+func (self *Pool) nextAt(prio Priority, blocked bool) (task func(), ok bool) {
+	if q := self.tasks[prio]; q != nil {
+		for t, queued := q.dequeue(); queued; t, queued = q.dequeue() {
+			// skip the tasks withdrawn by their submitters
+			if t.claim() {
+				return t.task, true
+			}
+		}
+	}
+	if blocked {
+		if task, ok = self.waiters[prio].take(); ok {
+			atomic.AddUint64(&self.stats.submitted, 1)
+		}
+	}
+	return
+}
+
+// queued reports whether there are tasks held in the task queues
+func (self *Pool) queued() bool {
+	for _, q := range self.tasks {
+		if q != nil && !q.empty() {
+			return true
+		}
+	}
+	return false
+}
+
+// blocked reports whether there are submitters waiting for an available worker
+func (self *Pool) blocked() bool {
+	for prio := range self.waiters {
+		if !self.waiters[prio].empty() {
+			return true
+		}
+	}
+	return false
+}
+
+// retry wakes up the blocked submitter with the highest priority for submitting its task again
+// returns false if there is none
+func (self *Pool) retry() bool {
+	for prio := PriorityHigh; ; prio-- {
+		if self.waiters[prio].retry() {
+			return true
+		} else if prio == PriorityLow {
+			return false
+		}
+	}
+}
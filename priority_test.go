@@ -0,0 +1,76 @@
+package itogami
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestPriorityOrder(t *testing.T) {
+	p, err := NewPoolWithOptions(1, WithTaskQueue(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release()
+	release := occupy(t, p, 1)
+
+	var mu sync.Mutex
+	var order []Priority
+	var wg sync.WaitGroup
+	for _, prio := range []Priority{PriorityLow, PriorityNormal, PriorityHigh, PriorityLow, PriorityHigh} {
+		prio := prio
+		wg.Add(1)
+		if err := p.SubmitWithPriority(func() {
+			mu.Lock()
+			order = append(order, prio)
+			mu.Unlock()
+			wg.Done()
+		}, prio); err != nil {
+			t.Fatal(err)
+		}
+	}
+	release()
+	wg.Wait()
+	want := []Priority{PriorityHigh, PriorityHigh, PriorityNormal, PriorityLow, PriorityLow}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("tasks ran in priority order %v, want %v", order, want)
+		}
+	}
+}
+
+func TestPriorityStarvationGuard(t *testing.T) {
+	const high = 4 * starvationGuard
+	p, err := NewPoolWithOptions(1, WithTaskQueue(high))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release()
+	release := occupy(t, p, 1)
+
+	var mu sync.Mutex
+	var order []Priority
+	var wg sync.WaitGroup
+	run := func(prio Priority) func() {
+		return func() {
+			mu.Lock()
+			order = append(order, prio)
+			mu.Unlock()
+			wg.Done()
+		}
+	}
+	wg.Add(high + 1)
+	for i := 0; i < high; i++ {
+		p.SubmitWithPriority(run(PriorityHigh), PriorityHigh)
+	}
+	p.SubmitWithPriority(run(PriorityLow), PriorityLow)
+	release()
+	wg.Wait()
+	for i, prio := range order {
+		if prio == PriorityLow {
+			if i != starvationGuard-1 {
+				t.Fatalf("low priority task ran as task %d, want %d", i+1, starvationGuard)
+			}
+			return
+		}
+	}
+}
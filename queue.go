@@ -0,0 +1,84 @@
+package itogami
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// bounded lock-free multi-producer multi-consumer queue used for holding pending tasks
+// Credits -> https://www.1024cores.net/home/lock-free-algorithms/queues/bounded-mpmc-queue
+type queue[T any] struct {
+	head uint64
+	_p1  [cacheLinePadSize - unsafe.Sizeof(uint64(0))]byte
+	tail uint64
+	_p2  [cacheLinePadSize - unsafe.Sizeof(uint64(0))]byte
+	size uint64
+	// the sequence of a cell is 2*pos when it is free for being filled at position pos
+	// and 2*pos+1 once it is filled, which unlike the original algorithm also works for a single cell
+	cells []cell[T]
+}
+
+// a single cell in the queue
+type cell[T any] struct {
+	seq  uint64
+	data T
+}
+
+// newQueue returns a new queue which can hold at most size values
+func newQueue[T any](size uint64) *queue[T] {
+	q := &queue[T]{size: size, cells: make([]cell[T], size)}
+	for i := range q.cells {
+		q.cells[i].seq = 2 * uint64(i)
+	}
+	return q
+}
+
+// enqueue adds a value at the tail of the queue, returns false if the queue is full
+func (self *queue[T]) enqueue(value T) bool {
+	var (
+		c   *cell[T]
+		pos = atomic.LoadUint64(&self.tail)
+	)
+	for {
+		c = &self.cells[pos%self.size]
+		if diff := int64(atomic.LoadUint64(&c.seq) - 2*pos); diff == 0 {
+			if atomic.CompareAndSwapUint64(&self.tail, pos, pos+1) {
+				break
+			}
+		} else if diff < 0 {
+			return false
+		}
+		pos = atomic.LoadUint64(&self.tail)
+	}
+	c.data = value
+	atomic.StoreUint64(&c.seq, 2*pos+1)
+	return true
+}
+
+// dequeue removes a value from the head of the queue, returns false if the queue is empty
+func (self *queue[T]) dequeue() (value T, ok bool) {
+	var (
+		c    *cell[T]
+		zero T
+		pos  = atomic.LoadUint64(&self.head)
+	)
+	for {
+		c = &self.cells[pos%self.size]
+		if diff := int64(atomic.LoadUint64(&c.seq) - (2*pos + 1)); diff == 0 {
+			if atomic.CompareAndSwapUint64(&self.head, pos, pos+1) {
+				break
+			}
+		} else if diff < 0 {
+			return
+		}
+		pos = atomic.LoadUint64(&self.head)
+	}
+	value, c.data = c.data, zero
+	atomic.StoreUint64(&c.seq, 2*(pos+self.size))
+	return value, true
+}
+
+// empty reports whether there are no values in the queue including the ones which are still being enqueued
+func (self *queue[T]) empty() bool {
+	return atomic.LoadUint64(&self.head) >= atomic.LoadUint64(&self.tail)
+}
@@ -0,0 +1,83 @@
+package itogami
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// lock-free token bucket limiting the rate of task starts of a pool
+// implemented with the generic cell rate algorithm which tracks the theoretical arrival time of the next task
+// in a single word instead of a token count and a refill timestamp
+// Credits -> https://en.wikipedia.org/wiki/Generic_cell_rate_algorithm
+type limiter struct {
+	// theoretical arrival time of the next task in nanoseconds
+	tat int64
+	// time in nanoseconds it takes for a single token to refill
+	interval int64
+	// time in nanoseconds the arrival time can run ahead of the current time, allowing for bursts
+	tolerance int64
+}
+
+// newLimiter returns a new limiter allowing rate tasks per second with bursts of up to burst tasks
+func newLimiter(rate float64, burst uint64) *limiter {
+	interval := int64(float64(time.Second) / rate)
+	if interval < 1 {
+		interval = 1
+	}
+	return &limiter{interval: interval, tolerance: int64(burst-1) * interval}
+}
+
+// take takes a token if one is available and returns zero
+// otherwise returns the time to wait until the next token is available
+func (self *limiter) take() time.Duration {
+	for {
+		now := nanotime()
+		prev := atomic.LoadInt64(&self.tat)
+		tat := prev
+		if tat < now {
+			tat = now
+		}
+		if wait := tat - self.tolerance - now; wait > 0 {
+			return time.Duration(wait)
+		} else if atomic.CompareAndSwapInt64(&self.tat, prev, tat+self.interval) {
+			return 0
+		}
+	}
+}
+
+// refund hands back a token taken for a task which was not started after all
+func (self *limiter) refund() {
+	atomic.AddInt64(&self.tat, -self.interval)
+}
+
+// wait takes a token, waiting for one to be available unless the pool is non-blocking in which case
+// ErrRateLimited is returned, a throttled submission is counted in stats
+// returns the context error if the context is done before a token is available, a nil context waits without any deadline
+func (self *limiter) wait(ctx context.Context, nonblocking bool, stats *counters) error {
+	wait := self.take()
+	if wait == 0 {
+		return nil
+	}
+	atomic.AddUint64(&stats.throttled, 1)
+	if nonblocking {
+		return ErrRateLimited
+	}
+	var done <-chan struct{}
+	if ctx != nil {
+		done = ctx.Done()
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+		case <-done:
+			return ctx.Err()
+		}
+		if wait = self.take(); wait == 0 {
+			return nil
+		}
+		timer.Reset(wait)
+	}
+}
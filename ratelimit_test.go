@@ -0,0 +1,104 @@
+package itogami
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimitNonblockingBurst(t *testing.T) {
+	p, err := NewPoolWithOptions(4, WithNonblocking(true), WithRateLimit(10, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release()
+	for i := 0; i < 2; i++ {
+		if err := p.Submit(func() {}); err != nil {
+			t.Fatalf("Submit within the burst = %v", err)
+		}
+	}
+	if err := p.Submit(func() {}); err != ErrRateLimited {
+		t.Fatalf("Submit beyond the burst = %v, want %v", err, ErrRateLimited)
+	}
+	// a token is available again after the interval of the rate
+	time.Sleep(110 * time.Millisecond)
+	if err := p.Submit(func() {}); err != nil {
+		t.Fatalf("Submit after the interval = %v", err)
+	}
+}
+
+func TestRateLimitBlockingSubmittersWait(t *testing.T) {
+	const rate, tasks = 50, 5
+	p, err := NewPoolWithOptions(2, WithRateLimit(rate, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release()
+	begin := time.Now()
+	for i := 0; i < tasks; i++ {
+		if err := p.Submit(func() {}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d, want := time.Since(begin), (tasks-1)*time.Second/rate; d < want*9/10 {
+		t.Fatalf("%d tasks were submitted within %s, want at least %s", tasks, d, want)
+	}
+}
+
+func TestRateLimitRejectedSubmissionsAreRefunded(t *testing.T) {
+	p, err := NewPoolWithOptions(1, WithNonblocking(true), WithRateLimit(1, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release()
+	release := occupy(t, p, 1)
+	for i := 0; i < 10; i++ {
+		if err := p.Submit(func() {}); err != ErrPoolOverload {
+			t.Fatalf("Submit on a saturated pool = %v, want %v", err, ErrPoolOverload)
+		}
+		if p.TrySubmit(func() {}) {
+			t.Fatal("TrySubmit succeeded on a saturated pool")
+		}
+	}
+	release()
+	// the second token of the burst is still available
+	waitFor(t, "the worker to be available", func() bool { return p.Stats().Idle == 1 })
+	if err := p.Submit(func() {}); err != nil {
+		t.Fatalf("Submit after rejected submissions = %v", err)
+	}
+	if err := p.Submit(func() {}); err != ErrRateLimited {
+		t.Fatalf("Submit beyond the burst = %v, want %v", err, ErrRateLimited)
+	}
+}
+
+func TestRateLimitQueuedTasksChargedAtStart(t *testing.T) {
+	const rate, tasks = 20, 4
+	p, err := NewPoolWithOptions(1, WithRateLimit(rate, 1), WithTaskQueue(tasks))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release()
+
+	var mu sync.Mutex
+	var starts []time.Time
+	var wg sync.WaitGroup
+	begin := time.Now()
+	for i := 0; i < tasks; i++ {
+		wg.Add(1)
+		if err := p.Submit(func() {
+			mu.Lock()
+			starts = append(starts, time.Now())
+			mu.Unlock()
+			wg.Done()
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(begin); d > time.Second/rate {
+		t.Fatalf("submitters waited %s although the tasks could be queued", d)
+	}
+	wg.Wait()
+	if d, want := starts[tasks-1].Sub(starts[0]), (tasks-1)*time.Second/rate; d < want*9/10 {
+		t.Fatalf("queued tasks started within %s, want at least %s", d, want)
+	}
+}
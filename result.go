@@ -0,0 +1,169 @@
+package itogami
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+)
+
+type (
+	// a single value invoked on a PoolWithResult along with the future for its result, nil in results channel mode
+	resultCall[T, R any] struct {
+		value  T
+		future *Future[R]
+	}
+
+	// Result holds the result of a value sent to a PoolWithResult configured with a results channel
+	Result[T, R any] struct {
+		Value  T
+		Result R
+		Err    error
+	}
+
+	// PoolWithResult is used for spawning workers for a single pre-defined function returning a result
+	// the invocations run on a PoolWithFunc, hence sharing its worker slots and pooled stack nodes
+	//
+	//	( type -> func(T) (R, error) {} ) where T and R are generic parameters
+	PoolWithResult[T, R any] struct {
+		pool *PoolWithFunc[resultCall[T, R]]
+		task func(T) (R, error)
+		// nil unless the pool was configured with WithResults
+		results chan Result[T, R]
+	}
+)
+
+// NewPoolWithResult returns a new PoolWithResult
+func NewPoolWithResult[T, R any](size uint64, task func(T) (R, error)) *PoolWithResult[T, R] {
+	return newPoolWithResult(size, task, options{})
+}
+
+// NewPoolWithResultOptions returns a new PoolWithResult configured with the given options
+// returns ErrInvalidPoolSize if the size is zero or an error wrapping ErrInvalidOptions for an invalid configuration
+func NewPoolWithResultOptions[T, R any](size uint64, task func(T) (R, error), opts ...Option) (*PoolWithResult[T, R], error) {
+	o, err := loadOptions(size, opts)
+	if err != nil {
+		return nil, err
+	} else if task == nil {
+		return nil, fmt.Errorf("%w: nil task", ErrInvalidOptions)
+	} else if o.queueSize > 0 {
+		return nil, fmt.Errorf("%w: task queue is not supported by PoolWithResult", ErrInvalidOptions)
+	}
+	return newPoolWithResult(size, task, o), nil
+}
+
+// newPoolWithResult returns a new PoolWithResult with already validated options
+func newPoolWithResult[T, R any](size uint64, task func(T) (R, error), o options) *PoolWithResult[T, R] {
+	p := &PoolWithResult[T, R]{task: task}
+	if o.results {
+		p.results = make(chan Result[T, R], o.resultBuffer)
+	}
+	p.pool = newPoolWithFunc(size, p.call, o)
+	if p.results != nil {
+		// no worker is left to deliver a result once the pool is terminated
+		go func() {
+			<-p.pool.done
+			close(p.results)
+		}()
+	}
+	return p
+}
+
+// Invoke invokes the pre-defined function with the value like PoolWithFunc.Invoke and returns a future for its result
+// a panicking invocation resolves the future with a *PanicError which is reported by the pool like any other panic
+// if the value could not be invoked, the future is resolved with the error of the pool
+func (self *PoolWithResult[T, R]) Invoke(value T) *Future[R] {
+	return self.invoke(nil, value)
+}
+
+// InvokeContext invokes the pre-defined function with the value like Invoke but stops waiting for an available worker
+// once the context is cancelled or its deadline passes, in which case the future is resolved with the context error
+func (self *PoolWithResult[T, R]) InvokeContext(ctx context.Context, value T) *Future[R] {
+	return self.invoke(ctx, value)
+}
+
+// invoke invokes the pre-defined function with the value along with a new future for its result
+func (self *PoolWithResult[T, R]) invoke(ctx context.Context, value T) *Future[R] {
+	f := newFuture[R]()
+	if err := self.pool.invoke(ctx, resultCall[T, R]{value: value, future: f}); err != nil {
+		var zero R
+		f.resolve(zero, err)
+	}
+	return f
+}
+
+// Send invokes the pre-defined function with the value like PoolWithFunc.Invoke and delivers its result on the
+// results channel instead of a future, saving the allocation of the future
+// returns ErrNoResults if the pool was not configured with WithResults or the error of the pool if the value could not be invoked
+func (self *PoolWithResult[T, R]) Send(value T) error {
+	return self.send(nil, value)
+}
+
+// SendContext sends the value like Send but stops waiting for an available worker once the context is cancelled
+// or its deadline passes, in which case the context error is returned
+func (self *PoolWithResult[T, R]) SendContext(ctx context.Context, value T) error {
+	return self.send(ctx, value)
+}
+
+// send invokes the pre-defined function with the value for delivering its result on the results channel
+func (self *PoolWithResult[T, R]) send(ctx context.Context, value T) error {
+	if self.results == nil {
+		return ErrNoResults
+	}
+	return self.pool.invoke(ctx, resultCall[T, R]{value: value})
+}
+
+// Results returns the channel on which the results of the values passed to Send are delivered, nil unless the pool
+// was configured with WithResults, the channel is closed once the pool is released and all workers have exited
+// it must be consumed for as long as values are sent
+func (self *PoolWithResult[T, R]) Results() <-chan Result[T, R] {
+	return self.results
+}
+
+// call runs the pre-defined function on a worker and delivers its result
+// a panic is delivered as a *PanicError and then propagated to the pool so that it is reported and counted
+func (self *PoolWithResult[T, R]) call(c resultCall[T, R]) {
+	defer func() {
+		if r := recover(); r != nil {
+			var zero R
+			self.deliver(c, zero, &PanicError{Value: r, Stack: debug.Stack()})
+			panic(r)
+		}
+	}()
+	value, err := self.task(c.value)
+	self.deliver(c, value, err)
+}
+
+// deliver resolves the future of the invocation or hands the result to the results channel
+func (self *PoolWithResult[T, R]) deliver(c resultCall[T, R], value R, err error) {
+	if c.future != nil {
+		c.future.resolve(value, err)
+	} else {
+		self.results <- Result[T, R]{Value: c.value, Result: value, Err: err}
+	}
+}
+
+// Warm spawns up to n idle workers within the pool capacity, see PoolWithFunc.Warm
+func (self *PoolWithResult[T, R]) Warm(n uint64) uint64 {
+	return self.pool.Warm(n)
+}
+
+// Stats returns a snapshot of the current state and the cumulative counters of the pool
+func (self *PoolWithResult[T, R]) Stats() Stats {
+	return self.pool.Stats()
+}
+
+// Tune changes the capacity of the pool, see PoolWithFunc.Tune
+func (self *PoolWithResult[T, R]) Tune(size uint64) {
+	self.pool.Tune(size)
+}
+
+// Release closes the pool and wakes up all parked workers so that they can exit, see PoolWithFunc.Release
+func (self *PoolWithResult[T, R]) Release() {
+	self.pool.Release()
+}
+
+// Shutdown releases the pool and waits for all in-flight invocations to finish and their workers to exit
+// returns the context error if the context is done before that
+func (self *PoolWithResult[T, R]) Shutdown(ctx context.Context) error {
+	return self.pool.Shutdown(ctx)
+}
@@ -0,0 +1,84 @@
+package itogami
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestPoolWithResultFutures(t *testing.T) {
+	errBad := errors.New("bad")
+	p, err := NewPoolWithResultOptions(4, func(n int) (int, error) {
+		switch n {
+		case 7:
+			return 0, errBad
+		case 9:
+			panic("nine")
+		}
+		return n * n, nil
+	}, WithPanicHandler(func(any) {}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	futures := make([]*Future[int], 100)
+	for i := range futures {
+		futures[i] = p.Invoke(i)
+	}
+	for i, f := range futures {
+		v, err := f.Get()
+		switch i {
+		case 7:
+			if err != errBad {
+				t.Fatalf("future %d resolved with %v, want %v", i, err, errBad)
+			}
+		case 9:
+			var perr *PanicError
+			if !errors.As(err, &perr) {
+				t.Fatalf("future %d resolved with %v, want a *PanicError", i, err)
+			}
+		default:
+			if err != nil || v != i*i {
+				t.Fatalf("future %d resolved with %d, %v", i, v, err)
+			}
+		}
+	}
+	if err := p.Send(1); err != ErrNoResults {
+		t.Fatalf("Send without a results channel = %v, want %v", err, ErrNoResults)
+	}
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Invoke(1).Get(); err != ErrPoolClosed {
+		t.Fatalf("future of an invocation after Shutdown resolved with %v, want %v", err, ErrPoolClosed)
+	}
+	if s := p.Stats(); s.Completed != 100 || s.Panics != 1 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+func TestPoolWithResultChannel(t *testing.T) {
+	p, err := NewPoolWithResultOptions(3, func(n int) (int, error) { return n + 1, nil }, WithResults(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := make(chan int)
+	go func() {
+		total := 0
+		for r := range p.Results() {
+			if r.Err != nil || r.Result != r.Value+1 {
+				t.Errorf("unexpected result %+v", r)
+			}
+			total += r.Result
+		}
+		sum <- total
+	}()
+	for i := 0; i < 1000; i++ {
+		if err := p.Send(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p.Release()
+	if total := <-sum; total != 500500 {
+		t.Fatalf("results sum up to %d, want 500500", total)
+	}
+}
@@ -0,0 +1,86 @@
+package itogami
+
+import (
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// Stats is a snapshot of the state of a pool along with its cumulative counters
+type Stats struct {
+	// number of live workers, both busy and parked
+	Running uint64
+	// number of workers parked on the stack waiting for a task
+	Idle uint64
+	// maximum number of workers
+	Capacity uint64
+	// total number of tasks accepted by the pool
+	Submitted uint64
+	// total number of tasks which finished executing, including the ones which panicked
+	Completed uint64
+	// total number of tasks which panicked
+	Panics uint64
+	// cumulative time callers spent waiting in Submit / Invoke for an available worker
+	WaitTime time.Duration
+	// number of submitters currently waiting for an available worker, bounded by WithMaxBlockingTasks
+	Blocking uint64
+	// total number of submissions which were delayed or rejected by the rate limit
+	Throttled uint64
+	// total number of tasks submitted with a timeout which were still running past it
+	TimedOut uint64
+}
+
+// counters maintained by a pool, every frequently updated counter lies on its own cache line
+// to prevent false sharing between submitters and workers
+type counters struct {
+	_p0       cacheLinePadding
+	submitted uint64
+	_p1       [cacheLinePadSize - unsafe.Sizeof(uint64(0))]byte
+	completed uint64
+	_p2       [cacheLinePadSize - unsafe.Sizeof(uint64(0))]byte
+	idle      uint64
+	_p3       [cacheLinePadSize - unsafe.Sizeof(uint64(0))]byte
+	panics    uint64
+	waitTime  uint64
+	// number of submitters currently waiting for an available worker
+	blocking uint64
+	// number of submissions delayed or rejected by the rate limit
+	throttled uint64
+	// number of tasks still running past their timeout
+	timedOut uint64
+}
+
+// block registers a submitter which is about to wait for an available worker
+// returns false if there are already max submitters waiting, zero means no limit
+func (self *counters) block(max uint64) bool {
+	if atomic.AddUint64(&self.blocking, 1) > max && max > 0 {
+		atomic.AddUint64(&self.blocking, uint64SubtractionConstant)
+		return false
+	}
+	return true
+}
+
+// waited unregisters a waiting submitter and adds the time elapsed since start to the cumulative wait time
+// start is zero if the submitter never had to wait
+func (self *counters) waited(start int64) {
+	if start != 0 {
+		atomic.AddUint64(&self.blocking, uint64SubtractionConstant)
+		atomic.AddUint64(&self.waitTime, uint64(nanotime()-start))
+	}
+}
+
+// snapshot loads all counters into stats
+func (self *counters) snapshot(running, capacity uint64) Stats {
+	return Stats{
+		Running:   running,
+		Idle:      atomic.LoadUint64(&self.idle),
+		Capacity:  capacity,
+		Submitted: atomic.LoadUint64(&self.submitted),
+		Completed: atomic.LoadUint64(&self.completed),
+		Panics:    atomic.LoadUint64(&self.panics),
+		WaitTime:  time.Duration(atomic.LoadUint64(&self.waitTime)),
+		Blocking:  atomic.LoadUint64(&self.blocking),
+		Throttled: atomic.LoadUint64(&self.throttled),
+		TimedOut:  atomic.LoadUint64(&self.timedOut),
+	}
+}
@@ -0,0 +1,48 @@
+package itogami
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// states of a task submitted with a timeout
+const (
+	taskRunning uint32 = iota
+	taskFinished
+	taskTimedOut
+)
+
+// SubmitWithTimeout submits a new task to the pool like Submit, the task is handed a context which is cancelled
+// once it has been running for longer than the timeout, the time spent waiting for a worker does not count
+// the task is expected to return as soon as the context is done, as it keeps its worker busy until it does
+// tasks still running past the timeout are counted in Stats.TimedOut and reported to the timeout handler if any
+func (self *Pool) SubmitWithTimeout(timeout time.Duration, task func(context.Context)) error {
+	return self.submit(nil, func() { self.runWithTimeout(timeout, task) }, PriorityNormal)
+}
+
+// runWithTimeout runs the task on the worker with a context cancelled after the timeout
+func (self *Pool) runWithTimeout(timeout time.Duration, task func(context.Context)) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	state := taskRunning
+	// reports the timeout once, either from the timer while the task is still running
+	// or from the worker if the task returned after its context expired but before the timer fired
+	expire := func() {
+		if atomic.CompareAndSwapUint32(&state, taskRunning, taskTimedOut) {
+			atomic.AddUint64(&self.stats.timedOut, 1)
+			if self.opts.timeoutHandler != nil {
+				self.opts.timeoutHandler()
+			}
+		}
+	}
+	timer := time.AfterFunc(timeout, expire)
+	defer func() {
+		if ctx.Err() == context.DeadlineExceeded {
+			expire()
+		} else if atomic.CompareAndSwapUint32(&state, taskRunning, taskFinished) {
+			timer.Stop()
+		}
+		cancel()
+	}()
+	task(ctx)
+}
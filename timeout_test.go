@@ -0,0 +1,45 @@
+package itogami
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSubmitWithTimeout(t *testing.T) {
+	var handled int64
+	p, err := NewPoolWithOptions(4, WithTimeoutHandler(func() { atomic.AddInt64(&handled, 1) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release()
+
+	var expired int64
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		stuck := i%2 == 0
+		wg.Add(1)
+		if err := p.SubmitWithTimeout(10*time.Millisecond, func(ctx context.Context) {
+			defer wg.Done()
+			if !stuck {
+				return
+			}
+			<-ctx.Done()
+			if ctx.Err() == context.DeadlineExceeded {
+				atomic.AddInt64(&expired, 1)
+			}
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+	if expired != 10 {
+		t.Fatalf("%d task contexts expired, want 10", expired)
+	}
+	waitFor(t, "the timed out tasks to be reported", func() bool { return atomic.LoadInt64(&handled) == 10 })
+	if s := p.Stats(); s.TimedOut != 10 {
+		t.Fatalf("TimedOut = %d, want 10", s.TimedOut)
+	}
+}
@@ -0,0 +1,160 @@
+package itogami
+
+import (
+	"context"
+	"sync/atomic"
+	"unsafe"
+)
+
+// states of a waiter
+const (
+	waiterPending uint32 = iota
+	// the task of the waiter has been taken over by a worker or the waiter has been woken up for retrying
+	waiterClaimed
+	waiterCancelled
+)
+
+// waiter is a submitter parked on a saturated pool until a worker takes over its task
+// also serves as a node in the wait list
+type waiter[T any] struct {
+	parker
+	// set for waiters bound to a context, these are signalled over the channel instead of being parked
+	// so that they can stop waiting once the context is done
+	notify chan struct{}
+	// task or value submitted by the waiter
+	value T
+	// set once a worker has taken over the task, unset if the waiter was only woken up for retrying
+	accepted bool
+	state    uint32
+	next     atomic.Pointer[waiter[T]]
+}
+
+// newWaiter returns a new waiter for the value bound to the calling goroutine
+func newWaiter[T any](value T, cancellable bool) *waiter[T] {
+	w := &waiter[T]{value: value}
+	if cancellable {
+		w.notify = make(chan struct{}, 1)
+	} else {
+		w.bind()
+	}
+	return w
+}
+
+// cancel withdraws a pending waiter, returns false if it has already been claimed
+// in which case the waiter is about to be woken up
+func (self *waiter[T]) cancel() bool {
+	return atomic.CompareAndSwapUint32(&self.state, waiterPending, waiterCancelled)
+}
+
+// wake wakes up the waiter after it has been claimed
+func (self *waiter[T]) wake() {
+	if self.notify != nil {
+		self.notify <- struct{}{}
+	} else {
+		self.ready()
+	}
+}
+
+// await parks the waiter until it is claimed and reports whether its task has been taken over by a worker
+// returns the context error if the context is done before the waiter is claimed
+func (self *waiter[T]) await(ctx context.Context) (bool, error) {
+	if self.notify == nil {
+		self.park()
+		return self.accepted, nil
+	}
+	select {
+	case <-self.notify:
+	case <-ctx.Done():
+		if self.cancel() {
+			return false, ctx.Err()
+		}
+		<-self.notify
+	}
+	return self.accepted, nil
+}
+
+// lock-free FIFO list of waiters based on the Michael-Scott queue
+// Credits -> https://www.cs.rochester.edu/u/scott/papers/1996_PODC_queues.pdf
+// the head always points to a sentinel which is the last dequeued waiter
+type waitList[T any] struct {
+	head atomic.Pointer[waiter[T]]
+	_p1  [cacheLinePadSize - unsafe.Sizeof(atomic.Pointer[waiter[T]]{})]byte
+	tail atomic.Pointer[waiter[T]]
+	_p2  [cacheLinePadSize - unsafe.Sizeof(atomic.Pointer[waiter[T]]{})]byte
+}
+
+// init sets up the sentinel, must be called before the list is used
+func (self *waitList[T]) init() {
+	sentinel := new(waiter[T])
+	self.head.Store(sentinel)
+	self.tail.Store(sentinel)
+}
+
+// enqueue appends the waiter at the tail of the list
+func (self *waitList[T]) enqueue(w *waiter[T]) {
+	for {
+		tail := self.tail.Load()
+		if next := tail.next.Load(); next != nil {
+			// help a concurrent enqueue in moving the tail forward
+			self.tail.CompareAndSwap(tail, next)
+		} else if tail.next.CompareAndSwap(nil, w) {
+			self.tail.CompareAndSwap(tail, w)
+			return
+		}
+	}
+}
+
+// dequeue removes the waiter at the head of the list, returns nil if the list is empty
+func (self *waitList[T]) dequeue() *waiter[T] {
+	for {
+		head := self.head.Load()
+		next := head.next.Load()
+		if next == nil {
+			return nil
+		} else if tail := self.tail.Load(); tail == head {
+			self.tail.CompareAndSwap(tail, next)
+		} else if self.head.CompareAndSwap(head, next) {
+			return next
+		}
+	}
+}
+
+// empty reports whether there are no waiters in the list including the cancelled ones which are yet to be dropped
+func (self *waitList[T]) empty() bool {
+	return self.head.Load().next.Load() == nil
+}
+
+// claim removes the first pending waiter from the list, dropping cancelled waiters on the way
+// returns nil if there is no pending waiter
+func (self *waitList[T]) claim() *waiter[T] {
+	for w := self.dequeue(); w != nil; w = self.dequeue() {
+		if atomic.CompareAndSwapUint32(&w.state, waiterPending, waiterClaimed) {
+			return w
+		}
+	}
+	return nil
+}
+
+// take takes over the task of the first pending waiter and wakes it up
+// returns false if there is no pending waiter
+func (self *waitList[T]) take() (value T, ok bool) {
+	if w := self.claim(); w != nil {
+		var zero T
+		// the waiter stays referenced as the sentinel of the list
+		value, w.value = w.value, zero
+		w.accepted = true
+		w.wake()
+		return value, true
+	}
+	return
+}
+
+// retry wakes up the first pending waiter for submitting its task again
+// returns false if there is no pending waiter
+func (self *waitList[T]) retry() bool {
+	if w := self.claim(); w != nil {
+		w.wake()
+		return true
+	}
+	return false
+}